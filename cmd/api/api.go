@@ -1,11 +1,13 @@
 package api
 
 import (
+	"context"
 	"github.com/zcvaters/gmap-to-gpx/cmd/api/handlers"
 	"github.com/zcvaters/gmap-to-gpx/cmd/configure/environment"
 	"github.com/zcvaters/gmap-to-gpx/cmd/configure/logging"
 	"github.com/zcvaters/gmap-to-gpx/cmd/configure/router"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
 )
 
@@ -18,9 +20,19 @@ func StartAPI() {
 		Log:         log,
 	}
 	s.MountHandlers(h)
+	if env.Retention > 0 {
+		go runJanitor(context.Background(), env, log)
+	}
 	log.Infow("starting API", zap.String("address", env.Address))
 	log.Fatalw("failed to start API", zap.Error(http.ListenAndServe(env.Address, s.Router)))
-	if err := env.GCP.StorageClient.Close(); err != nil {
-		log.Errorf("failed to close GCP client: %v", err)
+	if closer, ok := env.Storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Errorf("failed to close storage: %v", err)
+		}
+	}
+	if closer, ok := env.Elevation.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Errorf("failed to close elevation provider: %v", err)
+		}
 	}
 }
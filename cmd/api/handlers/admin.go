@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// PurgeFile deletes a stored conversion ahead of the retention period. It requires the configured admin token as a
+// bearer token, and does not exist without one.
+func (h *Handlers) PurgeFile(w http.ResponseWriter, r *http.Request) http.Handler {
+	token := h.Environment.AdminToken
+	if token == "" {
+		return Error(fmt.Errorf("not found"), http.StatusNotFound)
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		return Error(fmt.Errorf("unauthorized"), http.StatusUnauthorized)
+	}
+
+	key, err := routeKey(r)
+	if err != nil {
+		return Error(err, http.StatusBadRequest)
+	}
+	err = h.Environment.Storage.Delete(r.Context(), key)
+	if errors.Is(err, data.ErrInvalidKey) {
+		return Error(err, http.StatusBadRequest)
+	}
+	if errors.Is(err, data.ErrObjectNotFound) {
+		return Error(err, http.StatusNotFound)
+	}
+	if err != nil {
+		return Error(fmt.Errorf("failed to delete file: %q", err), http.StatusInternalServerError)
+	}
+
+	h.Log.Infow("purged stored conversion", zap.String("key", key))
+	return WithStatus(http.StatusNoContent, Text(""))
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DownloadFile serves the files of the local storage backend to the holders of a signed URL.
+func (h *Handlers) DownloadFile(w http.ResponseWriter, r *http.Request) http.Handler {
+	local, ok := h.Environment.Storage.(*data.LocalStorage)
+	if !ok {
+		return Error(fmt.Errorf("not found"), http.StatusNotFound)
+	}
+
+	key, err := routeKey(r)
+	if err != nil {
+		return Error(err, http.StatusBadRequest)
+	}
+
+	signed, err := local.Verify(key, r.URL.Query(), time.Now())
+	if err != nil {
+		return Error(err, http.StatusForbidden)
+	}
+
+	body, obj, err := local.Get(r.Context(), key)
+	if errors.Is(err, data.ErrInvalidKey) {
+		return Error(err, http.StatusBadRequest)
+	}
+	if errors.Is(err, data.ErrObjectNotFound) {
+		return Error(err, http.StatusNotFound)
+	}
+	if err != nil {
+		return Error(fmt.Errorf("failed to read file: %q", err), http.StatusInternalServerError)
+	}
+
+	contentType, disposition := obj.ContentType, obj.ContentDisposition
+	if signed.ContentType != "" {
+		contentType = signed.ContentType
+	}
+	if signed.ContentDisposition != "" {
+		disposition = signed.ContentDisposition
+	}
+	if obj.CacheControl != "" {
+		w.Header().Set("Cache-Control", obj.CacheControl)
+	}
+	return File(contentType, disposition, body)
+}
+
+// routeKey returns the object key matched by the wildcard of the route.
+func routeKey(r *http.Request) (string, error) {
+	key := chi.URLParam(r, "*")
+	if r.URL.RawPath == "" {
+		return key, nil
+	}
+	key, err := url.PathUnescape(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid key: %q", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"go.uber.org/zap"
+)
+
+// Elevation sources accepted in GMapToGPXRequest.ElevationSource. ElevationSourceAuto uses the route's own elevation
+// data and looks up the remaining points with the configured provider.
+const (
+	ElevationSourceAuto     = "auto"
+	ElevationSourceGMap     = "gmap"
+	ElevationSourceProvider = "provider"
+)
+
+func validElevationSource(source string) bool {
+	switch source {
+	case "", ElevationSourceAuto, ElevationSourceGMap, ElevationSourceProvider:
+		return true
+	}
+	return false
+}
+
+// lookupElevations returns the elevation of each location from source, nil where no elevation is available. partial
+// reports that the provider failed to look up part of the locations, so that another lookup may find more.
+func (h *Handlers) lookupElevations(ctx context.Context, source string, route *gmap.Route, locations []geo.LatLng) (elevations []*float64, partial bool, err error) {
+	elevations = make([]*float64, len(locations))
+	if source != ElevationSourceProvider {
+		upstream, err := gmap.DecodeElevation(route.Elevation, len(locations))
+		switch {
+		case err != nil && source == ElevationSourceGMap:
+			return nil, false, fmt.Errorf("failed to decode gMap elevation data: %q", err)
+		case err != nil:
+			h.Log.Warnw("ignoring gMap elevation data", zap.String("routeID", route.ResourceID), zap.Error(err))
+		default:
+			elevations = upstream
+		}
+	}
+	if source == ElevationSourceGMap {
+		return elevations, false, nil
+	}
+
+	var missing []int
+	var missingLocations []geo.LatLng
+	for i, elevation := range elevations {
+		if elevation == nil {
+			missing = append(missing, i)
+			missingLocations = append(missingLocations, locations[i])
+		}
+	}
+	if len(missing) == 0 {
+		return elevations, false, nil
+	}
+
+	looked, err := h.Environment.Elevation.Lookup(ctx, missingLocations)
+	var partialErr *data.PartialElevationError
+	if errors.As(err, &partialErr) {
+		h.Log.Warnw("missing elevation data for part of the route", zap.String("routeID", route.ResourceID), zap.Error(err))
+		partial = true
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch elevation data: %q", err)
+	}
+	for i, elevation := range looked {
+		elevations[missing[i]] = elevation
+	}
+
+	return elevations, partial, nil
+}
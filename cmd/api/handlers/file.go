@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxFileNameLength is the most characters kept of a file name, not counting the extension.
+const maxFileNameLength = 100
+
+// inlineDelivery reports whether the converted file should be returned in the response body instead of behind a
+// signed URL, either because of the inline query parameter or because the Accept header asks for the format itself.
+func inlineDelivery(r *http.Request, format export.Format) bool {
+	if inline, err := strconv.ParseBool(r.URL.Query().Get("inline")); err == nil {
+		return inline
+	}
+
+	contentType, _, _ := mime.ParseMediaType(format.ContentType)
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadName returns the file name the converted route is downloaded as. It is the sanitized FileName of the
+// request, or the route's name when none was requested, with the extension of the format.
+func downloadName(req *GMapToGPXRequest, route *gmap.Route, format export.Format) string {
+	name := req.FileName
+	if strings.EqualFold(path.Ext(name), format.Extension) {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	name = sanitizeFileName(name)
+	if name == "" {
+		name = sanitizeFileName(route.Name)
+	}
+	if name == "" {
+		name = fmt.Sprintf("route-%d", req.RouteID)
+	}
+	return name + format.Extension
+}
+
+// sanitizeFileName strips any directories from name and replaces characters other than letters, digits, spaces and
+// "._-()" so that the name is safe in object keys and on the file systems it is downloaded to. Leading dots are
+// removed so the download is never a hidden file.
+func sanitizeFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), strings.ContainsRune("._-()", r):
+			return r
+		case unicode.IsSpace(r):
+			return ' '
+		}
+		return '_'
+	}, name)
+	name = strings.Trim(name, " ._")
+
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = strings.TrimRight(string(runes[:maxFileNameLength]), " ._")
+	}
+	return name
+}
+
+// objectKey returns the key a conversion is stored under, a hash of the converter version, the configured elevation
+// providers and everything else that determines the converted file. Converting the same route the same way again
+// finds the stored file, as does asking for it with options the format ignores or their defaults.
+func (h *Handlers) objectKey(req *GMapToGPXRequest, route *gmap.Route, format export.Format, opts export.Options) string {
+	elevationSource := req.ElevationSource
+	if elevationSource == "" {
+		elevationSource = ElevationSourceAuto
+	}
+	// The providers only matter when they are asked for elevations.
+	var elevationProvider, elevationFallback string
+	if elevationSource != ElevationSourceGMap {
+		elevationProvider = strings.ToLower(h.Environment.ElevationProvider)
+		elevationFallback = strings.ToLower(h.Environment.ElevationFallback)
+	}
+	var startTime *time.Time
+	if req.StartTime != nil {
+		utc := req.StartTime.UTC()
+		startTime = &utc
+	}
+	key, _ := json.Marshal(struct {
+		Version           string
+		RouteID           int
+		PayloadHash       string
+		Format            string
+		Options           export.Options
+		ElevationSource   string
+		ElevationProvider string
+		ElevationFallback string
+		StartTime         *time.Time
+		Pace              float64
+		Speed             float64
+		GradeAdjusted     bool
+	}{
+		Version:           export.Version,
+		RouteID:           req.RouteID,
+		PayloadHash:       route.PayloadHash,
+		Format:            format.Name,
+		Options:           format.Normalize(opts),
+		ElevationSource:   elevationSource,
+		ElevationProvider: elevationProvider,
+		ElevationFallback: elevationFallback,
+		StartTime:         startTime,
+		Pace:              req.Pace,
+		Speed:             req.Speed,
+		GradeAdjusted:     req.GradeAdjusted,
+	})
+	hash := sha256.Sum256(key)
+	return data.ConversionPrefix + hex.EncodeToString(hash[:]) + format.Extension
+}
+
+// partialObjectKey returns a key that is never reused, for conversions that are missing elevations because of a
+// failed lookup. Converting the route again retries the lookup instead of finding the degraded file.
+func partialObjectKey(format export.Format) string {
+	return data.ConversionPrefix + "partial-" + data.CreateNewObjectKey(20) + format.Extension
+}
+
+// contentDisposition returns an attachment Content-Disposition header value for name.
+func contentDisposition(name string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
@@ -2,59 +2,71 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/zcvaters/gmap-to-gpx/cmd/data"
-	"googlemaps.github.io/maps"
-	"io"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"go.uber.org/zap"
 	"net/http"
-	"net/url"
 	"strconv"
-	"strings"
+	"time"
 )
 
-const GMapURL string = "https://www.gmap-pedometer.com"
-
 type GMapToGPXRequest struct {
 	FileName string `json:"fileName"`
 	RouteID  int    `json:"routeID"`
+	// ElevationSource is one of "auto" (default), "gmap" or "provider".
+	ElevationSource string `json:"elevationSource,omitempty"`
+	// Format is the output format, "gpx" (default), "kml", "geojson", "tcx", "fit", "csv", "tsv", "polyline", "wkt"
+	// or "ewkt".
+	Format string `json:"format,omitempty"`
+	// Precision is the number of decimals of the polyline format, 5 by default.
+	Precision int `json:"precision,omitempty"`
+	// GPXType is "track" (default), "route" or "both". Routes are thinned to MaxRoutePoints, at most 1000,
+	// when it is set.
+	GPXType        string `json:"gpxType,omitempty"`
+	MaxRoutePoints int    `json:"maxRoutePoints,omitempty"`
+	// Force2D writes WKT and EWKT as a plain LINESTRING, without it every point needs an elevation for LINESTRING Z.
+	Force2D bool `json:"force2D,omitempty"`
+	// StartTime together with either Pace in min/km or Speed in km/h timestamps every point. GradeAdjusted slows
+	// the pace on climbs and speeds it up on gentle descents.
+	StartTime     *time.Time `json:"startTime,omitempty"`
+	Pace          float64    `json:"pace,omitempty"`
+	Speed         float64    `json:"speed,omitempty"`
+	GradeAdjusted bool       `json:"gradeAdjusted,omitempty"`
 }
 
-type GMapToGPXResponse struct {
-	URL string `json:"url"`
-}
-
-type MapDataResp struct {
-	CenterX         string `json:"centerX"`
-	CenterY         string `json:"centerY"`
-	ZoomLevel       string `json:"zl"`
-	ZoomView        string `json:"zv"`
-	Filter          string `json:"fl"`
-	Polyline        string `json:"polyline"`
-	Elevation       string `json:"elev"`
-	ResourceID      string `json:"rId"`
-	RandomValue     string `json:"rdm"`
-	PointOfInterest string `json:"pta"`
-	Distance        string `json:"distance"`
-	ShowName        string `json:"show_name_description"`
-	Name            string `json:"name"`
-	Description     string `json:"description"`
+// speed returns the requested speed in m/s, or zero when no timestamps were requested.
+func (req *GMapToGPXRequest) speed() (float64, error) {
+	if req.Pace < 0 || req.Speed < 0 {
+		return 0, fmt.Errorf("pace and speed must be positive")
+	}
+	if req.StartTime == nil {
+		if req.Pace != 0 || req.Speed != 0 || req.GradeAdjusted {
+			return 0, fmt.Errorf("pace, speed and gradeAdjusted require a startTime")
+		}
+		return 0, nil
+	}
+	switch {
+	case req.Pace != 0 && req.Speed != 0:
+		return 0, fmt.Errorf("set either pace or speed, not both")
+	case req.Pace != 0:
+		return 1000 / (req.Pace * 60), nil
+	case req.Speed != 0:
+		return req.Speed / 3.6, nil
+	}
+	return 0, fmt.Errorf("startTime requires a pace or speed")
 }
 
-type ResultingGPX struct {
-	XMLName xml.Name `xml:"gpx"`
-	Creator string   `xml:"creator,attr,omitempty"`
-	Track   struct {
-		Name         string `xml:"name,omitempty"`
-		TrackSegment struct {
-			TrackPoint []struct {
-				Latitude  float64 `xml:"lat,attr"`
-				Longitude float64 `xml:"lon,attr"`
-				Elevation float64 `xml:"ele,omitempty"`
-			} `xml:"trkpt"`
-		} `xml:"trkseg"`
-	} `xml:"trk"`
+type GMapToGPXResponse struct {
+	URL string `json:"url"`
+	// MissingElevations counts the points left without an elevation because the elevation provider failed for part of
+	// the route. Converting the route again retries them.
+	MissingElevations int `json:"missingElevations,omitempty"`
 }
 
 type ResponseData struct {
@@ -74,137 +86,152 @@ func (h *Handlers) ConvertGMAPToGPX(w http.ResponseWriter, r *http.Request) http
 	if routeContext == nil {
 		return Error(fmt.Errorf("invalid request payload"), http.StatusBadRequest)
 	}
-	gMapURL := GMapURL + "/gp/ajaxRoute/get"
-	if routeContext.RouteID < 5000000 {
-		return Error(fmt.Errorf("invalid route ID: %d, must be greater than 5000000", routeContext.RouteID), http.StatusBadRequest)
+	if routeContext.RouteID < gmap.MinRouteID {
+		return Error(fmt.Errorf("invalid route ID: %d, must be greater than %d", routeContext.RouteID, gmap.MinRouteID), http.StatusBadRequest)
 	}
-
-	reqData := url.Values{"rId": {fmt.Sprint(routeContext.RouteID)}}.Encode()
-	gMapReq, err := http.NewRequest("POST", gMapURL, strings.NewReader(reqData))
-	if err != nil {
-		return Error(fmt.Errorf("failed to create gMap api request: %q", err), http.StatusInternalServerError)
+	if !validElevationSource(routeContext.ElevationSource) {
+		return Error(fmt.Errorf("invalid elevation source: %q", routeContext.ElevationSource), http.StatusBadRequest)
 	}
-	gMapReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(gMapReq)
+	format, ok := export.LookupFormat(routeContext.Format)
+	if !ok {
+		return Error(fmt.Errorf("invalid format: %q", routeContext.Format), http.StatusBadRequest)
+	}
+	if routeContext.Precision < 0 || routeContext.Precision > export.MaxPolylinePrecision {
+		return Error(fmt.Errorf("invalid precision: %d, must be between 1 and %d, or 0 for the default of %d", routeContext.Precision, export.MaxPolylinePrecision, export.DefaultPolylinePrecision), http.StatusBadRequest)
+	}
+	if !export.ValidGPXType(routeContext.GPXType) {
+		return Error(fmt.Errorf("invalid gpx type: %q", routeContext.GPXType), http.StatusBadRequest)
+	}
+	if routeContext.MaxRoutePoints < 0 || routeContext.MaxRoutePoints == 1 || routeContext.MaxRoutePoints > export.MaxRoutePointsLimit {
+		return Error(fmt.Errorf("invalid max route points: %d, must be between 2 and %d", routeContext.MaxRoutePoints, export.MaxRoutePointsLimit), http.StatusBadRequest)
+	}
+	speed, err := routeContext.speed()
 	if err != nil {
-		return Error(fmt.Errorf("failed gMap api request: %q", err), http.StatusInternalServerError)
+		return Error(err, http.StatusBadRequest)
+	}
+	opts := export.Options{
+		Precision:      routeContext.Precision,
+		GPXType:        routeContext.GPXType,
+		MaxRoutePoints: routeContext.MaxRoutePoints,
+		Force2D:        routeContext.Force2D,
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			h.Log.Errorf("failed to close response body, %v", err)
-		}
-	}(resp.Body)
 
-	respBody, err := io.ReadAll(resp.Body)
+	mapDataResp, err := h.Environment.GMap.GetRoute(r.Context(), routeContext.RouteID)
 	if err != nil {
-		return Error(fmt.Errorf("failed to read the gMap response body: %q", err), http.StatusInternalServerError)
+		return Error(fmt.Errorf("failed to fetch gMap route: %q", err), http.StatusInternalServerError)
 	}
-	query, err := url.ParseQuery(string(respBody))
-	if err != nil {
-		return Error(fmt.Errorf("failed to parse query parameters: %q", err), http.StatusInternalServerError)
-	}
-
-	mapDataResp := MapDataResp{}
-	mapDataResp.CenterX = query.Get("centerX")
-	mapDataResp.CenterY = query.Get("centerY")
-	mapDataResp.ZoomLevel = query.Get("zl")
-	mapDataResp.ZoomView = query.Get("zv")
-	mapDataResp.Filter = query.Get("fl")
-	mapDataResp.Polyline = query.Get("polyline")
-	mapDataResp.Elevation = query.Get("elev")
-	mapDataResp.ResourceID = query.Get("rId")
-	mapDataResp.RandomValue = query.Get("rdm")
-	mapDataResp.PointOfInterest = query.Get("pta")
-	mapDataResp.Distance = query.Get("distance")
-	mapDataResp.ShowName = query.Get("show_name_description")
-	mapDataResp.Name = query.Get("name")
-	mapDataResp.Description = query.Get("description")
-
-	resultGPX := &ResultingGPX{Creator: "gMapToGPX"}
 
+	track := &export.Track{
+		Name:        export.Creator,
+		Description: mapDataResp.Description,
+		Link:        h.Environment.GMap.RouteURL(routeContext.RouteID),
+		RouteID:     routeContext.RouteID,
+		Time:        time.Now(),
+	}
 	if mapDataResp.Name != "" {
-		resultGPX.Track.Name = mapDataResp.Name
-	} else {
-		resultGPX.Track.Name = "gMapToGPX"
+		track.Name = mapDataResp.Name
 	}
 
-	type trackPoint struct {
-		Latitude  float64 `xml:"lat,attr"`
-		Longitude float64 `xml:"lon,attr"`
-		Elevation float64 `xml:"ele,omitempty"`
-	}
-	polyStrings := strings.Split(mapDataResp.Polyline, "a")
-	if len(polyStrings) < 2 {
+	locations, err := gmap.DecodePolyline(mapDataResp.Polyline)
+	if errors.Is(err, gmap.ErrEmptyPolyline) {
 		return Error(fmt.Errorf("no route data for %v", routeContext.RouteID), http.StatusBadRequest)
 	}
-	for stringIndex := 0; stringIndex < len(polyStrings); stringIndex = stringIndex + 2 {
-		latitude, _ := strconv.ParseFloat(polyStrings[stringIndex], 64)
-		longitude, _ := strconv.ParseFloat(polyStrings[stringIndex+1], 64)
-		resultGPX.Track.TrackSegment.TrackPoint = append(resultGPX.Track.TrackSegment.TrackPoint, trackPoint{
-			Latitude:  latitude,
-			Longitude: longitude,
-		})
+	if err != nil {
+		return Error(fmt.Errorf("failed to decode route %v: %q", routeContext.RouteID, err), http.StatusInternalServerError)
+	}
+
+	name := downloadName(routeContext, mapDataResp, format)
+	inline := inlineDelivery(r, format)
+	obj := data.Object{
+		Key:                h.objectKey(routeContext, mapDataResp, format, opts),
+		ContentType:        format.ContentType,
+		ContentDisposition: contentDisposition(name),
+		CacheControl:       data.DefaultCacheControl,
+		Metadata: map[string]string{
+			"route-id":          strconv.Itoa(routeContext.RouteID),
+			"converter-version": export.Version,
+		},
+	}
+	// An identical conversion was stored before, hand out a new URL to it unless it may be purged before the URL
+	// expires. Converting it again renews it.
+	if !inline {
+		stored, err := h.Environment.Storage.Stat(r.Context(), obj.Key)
+		if err == nil && !h.expiring(stored) {
+			return h.signedDownload(r.Context(), obj, 0)
+		}
+		if err != nil && !errors.Is(err, data.ErrObjectNotFound) {
+			h.Log.Warnw("failed to look up stored conversion", zap.String("key", obj.Key), zap.Error(err))
+		}
 	}
 
-	eleReq := &maps.ElevationRequest{
-		Locations: nil,
+	pois, err := gmap.DecodePointsOfInterest(mapDataResp.PointOfInterest)
+	if err != nil {
+		h.Log.Warnw("ignoring invalid gMap points of interest", zap.Int("routeID", routeContext.RouteID), zap.Error(err))
 	}
-
-	for _, trackP := range resultGPX.Track.TrackSegment.TrackPoint {
-		eleReq.Locations = append(eleReq.Locations, maps.LatLng{
-			Lat: trackP.Latitude,
-			Lng: trackP.Longitude,
+	for _, poi := range pois {
+		track.Waypoints = append(track.Waypoints, export.Waypoint{
+			LatLng:      poi.LatLng,
+			Name:        poi.Name,
+			Description: poi.Description,
 		})
 	}
 
-	elevations, err := h.Environment.GCP.MapsClient.Elevation(r.Context(), eleReq)
+	elevations, partial, err := h.lookupElevations(r.Context(), routeContext.ElevationSource, mapDataResp, locations)
 	if err != nil {
-		return Error(fmt.Errorf("failed to fetch elevation data: %q", err), http.StatusInternalServerError)
-	}
-
-	for i, elevationResp := range elevations {
-		if elevationResp.Elevation != 0 {
-			resultGPX.Track.TrackSegment.TrackPoint[i].Elevation = elevationResp.Elevation
+		return Error(err, http.StatusInternalServerError)
+	}
+	missing := 0
+	if partial {
+		obj.Key = partialObjectKey(format)
+		for _, elevation := range elevations {
+			if elevation == nil {
+				missing++
+			}
 		}
 	}
 
-	gpxRes, err := xml.Marshal(resultGPX)
-	if err != nil {
-		return Error(fmt.Errorf("failed to marshal xml: %s", err), http.StatusInternalServerError)
+	for i, location := range locations {
+		track.Points = append(track.Points, geo.Point{LatLng: location, Elevation: elevations[i]})
 	}
-	key := data.CreateNewObjectKey(20)
-	uUrl, err := h.Environment.GCP.GetSignedUploadURL(key)
-	if err != nil {
-		return Error(fmt.Errorf("failed to create upload request: %q", err), http.StatusInternalServerError)
+	if routeContext.StartTime != nil {
+		geo.Timestamp(track.Points, *routeContext.StartTime, speed, routeContext.GradeAdjusted)
 	}
 
-	uploadReq, err := http.NewRequest(http.MethodPut, *uUrl, bytes.NewReader(gpxRes))
-	if err != nil {
-		return Error(fmt.Errorf("failed to create put request"), http.StatusInternalServerError)
+	var encoded bytes.Buffer
+	err = format.Encode(&encoded, track, opts)
+	if errors.Is(err, export.ErrMissingElevation) {
+		return Error(fmt.Errorf("failed to encode %s: %s, set force2D to leave elevations out", format.Name, err), http.StatusUnprocessableEntity)
 	}
-	uploadReq.Header.Set("Content-Type", "binary/octet-stream")
-
-	uploadRes, err := client.Do(uploadReq)
 	if err != nil {
-		return Error(fmt.Errorf("failed to upload payload: %s", err), http.StatusInternalServerError)
+		return Error(fmt.Errorf("failed to encode %s: %s", format.Name, err), http.StatusInternalServerError)
 	}
-
-	if uploadRes.StatusCode != http.StatusOK {
-		errBody, _ := io.ReadAll(uploadRes.Body)
-		return Error(fmt.Errorf("failed to upload file: %q", errBody), http.StatusInternalServerError)
+	if inline {
+		// Inline files have no JSON body to report missing elevations in.
+		if missing > 0 {
+			w.Header().Set("X-Missing-Elevations", strconv.Itoa(missing))
+		}
+		return File(format.ContentType, obj.ContentDisposition, encoded.Bytes())
+	}
+	if err := h.Environment.Storage.Put(r.Context(), obj, encoded.Bytes()); err != nil {
+		return Error(fmt.Errorf("failed to upload file: %s", err), http.StatusInternalServerError)
 	}
 
-	dUrl, err := h.Environment.GCP.GetSignedDownloadURL(key)
+	return h.signedDownload(r.Context(), obj, missing)
+}
+
+// expiring reports whether the retention period of obj ends before a URL signed now expires.
+func (h *Handlers) expiring(obj *data.Object) bool {
+	retention := h.Environment.Retention
+	return retention > 0 && time.Since(obj.Created) > retention-data.DefaultURLExpiry
+}
+
+// signedDownload responds with a signed URL to download the stored obj, which is missing the given number of
+// elevations.
+func (h *Handlers) signedDownload(ctx context.Context, obj data.Object, missingElevations int) http.Handler {
+	dUrl, err := h.Environment.Storage.SignedURL(ctx, obj, data.DefaultURLExpiry)
 	if err != nil {
 		return Error(fmt.Errorf("failed to get download url: %q", err), http.StatusInternalServerError)
 	}
 
-	if dUrl == nil {
-		return Error(fmt.Errorf("failed to download GPX file"), http.StatusInternalServerError)
-	}
-
-	return JSON(ResponseData{Data: GMapToGPXResponse{URL: *dUrl}})
+	return JSON(ResponseData{Data: GMapToGPXResponse{URL: dUrl, MissingElevations: missingElevations}})
 }
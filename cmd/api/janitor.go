@@ -0,0 +1,33 @@
+package api
+
+import (
+	"context"
+	"github.com/zcvaters/gmap-to-gpx/cmd/configure/environment"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"go.uber.org/zap"
+	"time"
+)
+
+// janitorInterval is how often expired conversions are purged.
+const janitorInterval = time.Hour
+
+// runJanitor deletes conversions older than the retention of env right away and then every janitorInterval, until
+// ctx is done.
+func runJanitor(ctx context.Context, env *environment.Environment, log *zap.SugaredLogger) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		deleted, err := data.PurgeExpired(ctx, env.Storage, data.ConversionPrefix, time.Now().Add(-env.Retention))
+		if err != nil {
+			log.Errorw("failed to purge expired conversions", zap.Int("deleted", deleted), zap.Error(err))
+		} else if deleted > 0 {
+			log.Infow("purged expired conversions", zap.Int("deleted", deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
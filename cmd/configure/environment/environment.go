@@ -3,17 +3,42 @@ package environment
 import (
 	"context"
 	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
 	"golang.org/x/exp/slog"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// APIPath is the prefix of every API route.
+	APIPath = "/api/v1"
+	// FilesRoute is the route below APIPath serving files of the local storage backend, signed download URLs of the
+	// local backend point to it.
+	FilesRoute = "/files"
 )
 
 type Environment struct {
-	ElevationAPIKey string
-	Address         string
-	Production      bool
-	GCP             *data.GCP
+	ElevationAPIKey   string
+	ElevationProvider string
+	ElevationFallback string
+	SRTMDir           string
+	SRTMCacheTiles    int
+	Address           string
+	GMapURL           string
+	Production        bool
+	StorageBackend    string
+	StorageDir        string
+	PublicURL         string
+	Storage           data.Storage
+	GMap              *gmap.Client
+	Elevation         data.ElevationProvider
+
+	// Retention is how long stored conversions are kept, forever when zero.
+	Retention  time.Duration
+	AdminToken string
 }
 
 func CreateNewEnv() *Environment {
@@ -31,9 +56,25 @@ func CreateNewEnv() *Environment {
 	}
 
 	gcpCtx := context.Background()
-	elevationApiKey, ok := os.LookupEnv("ELEVATION_API_KEY")
-	if !ok || elevationApiKey == "" {
-		log.Fatalf("elevation api key not set in enviroinment, have \"%s\"", elevationApiKey)
+	e.ElevationProvider = data.ElevationGoogle
+	if provider, ok := os.LookupEnv("ELEVATION_PROVIDER"); ok && provider != "" {
+		e.ElevationProvider = provider
+	}
+	e.ElevationFallback = os.Getenv("ELEVATION_FALLBACK")
+	e.ElevationAPIKey = os.Getenv("ELEVATION_API_KEY")
+	if e.ElevationFallback != "" && !strings.EqualFold(e.ElevationProvider, data.ElevationSRTM) {
+		log.Fatalf("ELEVATION_FALLBACK is only used by the %q elevation provider, have \"%s\"", data.ElevationSRTM, e.ElevationProvider)
+	}
+	usesGoogle := strings.EqualFold(e.ElevationProvider, data.ElevationGoogle) || strings.EqualFold(e.ElevationFallback, data.ElevationGoogle)
+	if usesGoogle && e.ElevationAPIKey == "" {
+		log.Fatalf("elevation api key not set in enviroinment, have \"%s\"", e.ElevationAPIKey)
+	}
+	e.SRTMDir = os.Getenv("SRTM_DIR")
+	if cacheTiles, ok := os.LookupEnv("SRTM_CACHE_TILES"); ok && cacheTiles != "" {
+		var err error
+		if e.SRTMCacheTiles, err = strconv.Atoi(cacheTiles); err != nil {
+			log.Fatalf("failed to parse SRTM_CACHE_TILES integer value, have \"%s\"", cacheTiles)
+		}
 	}
 
 	if address, ok := os.LookupEnv("ADDRESS"); !ok || address == "" {
@@ -42,29 +83,89 @@ func CreateNewEnv() *Environment {
 		e.Address = address
 	}
 
-	bucketID, ok := os.LookupEnv("BUCKET_ID")
-	if !ok {
-		log.Fatal("missing required environment variable BUCKET_ID")
+	e.GMapURL = gmap.DefaultBaseURL
+	if gMapURL, ok := os.LookupEnv("GMAP_URL"); ok && gMapURL != "" {
+		e.GMapURL = gMapURL
+	}
+
+	e.StorageBackend = data.StorageGCS
+	if backend, ok := os.LookupEnv("STORAGE_BACKEND"); ok && backend != "" {
+		e.StorageBackend = backend
 	}
-	accessID, ok := os.LookupEnv("ACCESS_ID")
-	if !ok {
-		log.Fatalf("missing required environment variable ACCESS_ID")
+	storageCfg := data.StorageConfig{Backend: e.StorageBackend}
+	if e.StorageBackend == data.StorageGCS {
+		bucketID, ok := os.LookupEnv("BUCKET_ID")
+		if !ok {
+			log.Fatal("missing required environment variable BUCKET_ID")
+		}
+		accessID, ok := os.LookupEnv("ACCESS_ID")
+		if !ok {
+			log.Fatalf("missing required environment variable ACCESS_ID")
+		}
+		storageCfg.BucketID = bucketID
+		storageCfg.AccessID = accessID
 	}
-	mapsClient, err := data.NewMapsClient(elevationApiKey)
+	if e.StorageBackend == data.StorageS3 {
+		bucketID, ok := os.LookupEnv("BUCKET_ID")
+		if !ok {
+			log.Fatal("missing required environment variable BUCKET_ID")
+		}
+		storageCfg.BucketID = bucketID
+		storageCfg.S3 = data.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}
+		if insecure, ok := os.LookupEnv("S3_INSECURE"); ok && insecure != "" {
+			var err error
+			if storageCfg.S3.Insecure, err = strconv.ParseBool(insecure); err != nil {
+				log.Fatalf("failed to parse S3_INSECURE boolean value, have \"%s\"", insecure)
+			}
+		}
+	}
+	if e.StorageBackend == data.StorageLocal {
+		e.StorageDir = os.Getenv("STORAGE_DIR")
+		e.PublicURL = "http://" + e.Address
+		if publicURL, ok := os.LookupEnv("PUBLIC_URL"); ok && publicURL != "" {
+			e.PublicURL = strings.TrimSuffix(publicURL, "/")
+		}
+		secret := os.Getenv("STORAGE_SECRET")
+		if secret == "" {
+			// Download URLs stop working on restart without a configured secret.
+			slog.Info("STORAGE_SECRET not set, signing download urls with a random secret")
+			secret = data.CreateNewObjectKey(32)
+		}
+		storageCfg.Dir = e.StorageDir
+		storageCfg.BaseURL = e.PublicURL + APIPath + FilesRoute
+		storageCfg.Secret = []byte(secret)
+	}
+	elevation, err := data.NewElevationProvider(data.ElevationConfig{
+		Provider:       e.ElevationProvider,
+		APIKey:         e.ElevationAPIKey,
+		SRTMDir:        e.SRTMDir,
+		SRTMCacheTiles: e.SRTMCacheTiles,
+		Fallback:       e.ElevationFallback,
+	})
 	if err != nil {
-		log.Fatalf("failed to configure maps client: %s", err)
+		log.Fatalf("failed to configure elevation provider: %s", err)
 	}
+	e.Elevation = elevation
 
-	storageClient, err := data.NewStorageClient(gcpCtx)
-	if err != nil {
-		log.Fatalf("failed to configure storage client: %s", err)
+	if retentionDays, ok := os.LookupEnv("RETENTION_DAYS"); ok && retentionDays != "" {
+		days, err := strconv.Atoi(retentionDays)
+		if err != nil || days < 0 {
+			log.Fatalf("failed to parse RETENTION_DAYS integer value, have \"%s\"", retentionDays)
+		}
+		e.Retention = time.Duration(days) * 24 * time.Hour
 	}
-	gcp := &data.GCP{
-		StorageClient: storageClient,
-		MapsClient:    mapsClient,
-		AccessID:      accessID,
-		BucketID:      bucketID,
+	e.AdminToken = os.Getenv("ADMIN_TOKEN")
+
+	storage, err := data.NewStorage(gcpCtx, storageCfg)
+	if err != nil {
+		log.Fatalf("failed to configure storage: %s", err)
 	}
-	e.GCP = gcp
+	e.Storage = storage
+	e.GMap = gmap.NewClient(e.GMapURL, gmap.DefaultTimeout)
 	return e
 }
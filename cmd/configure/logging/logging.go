@@ -123,8 +123,11 @@ func SendWebhookMsg(entry zapcore.Entry) {
 	req, _ := http.NewRequest("POST", url, bytes.NewReader(embedJson))
 	req.Header.Add("Content-Type", "application/json")
 
-	res, _ := http.DefaultClient.Do(req)
-
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("failed to send webhook message: %s\n", err)
+		return
+	}
 	defer res.Body.Close()
 }
 
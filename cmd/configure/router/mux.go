@@ -6,6 +6,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
 	"github.com/zcvaters/gmap-to-gpx/cmd/api/handlers"
+	"github.com/zcvaters/gmap-to-gpx/cmd/configure/environment"
 	"github.com/zcvaters/gmap-to-gpx/cmd/configure/logging"
 	"golang.org/x/exp/slog"
 	"net/http"
@@ -48,8 +49,10 @@ func (s *Server) MountHandlers(h *handlers.Handlers) {
 	}))
 	s.Router.Use(middleware.Recoverer)
 
-	s.Router.Route("/api/v1", func(r chi.Router) {
+	s.Router.Route(environment.APIPath, func(r chi.Router) {
 		r.Method("POST", "/gMapToGPX", Handler(h.ConvertGMAPToGPX))
+		r.Method("GET", environment.FilesRoute+"/*", Handler(h.DownloadFile))
+		r.Method("DELETE", "/admin"+environment.FilesRoute+"/*", Handler(h.PurgeFile))
 	})
 }
 
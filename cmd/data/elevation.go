@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/joomcode/errorx"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"googlemaps.github.io/maps"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ElevationGoogle = "google"
+	ElevationNone   = "none"
+	ElevationFake   = "fake"
+	ElevationSRTM   = "srtm"
+
+	// DefaultFakeElevation is the elevation returned by the configured fake provider.
+	DefaultFakeElevation = 100.0
+
+	// MaxElevationLocations is the most locations the Elevation API accepts in one request. DefaultElevationChunkSize
+	// stays below it so the encoded locations also fit the API's URL length limit.
+	MaxElevationLocations       = 512
+	DefaultElevationChunkSize   = 256
+	DefaultElevationConcurrency = 4
+)
+
+// ElevationProvider looks up the elevation in meters for each location. Results are in the same order as locations and
+// nil where the provider has no elevation, so that sea level stays distinguishable from unknown.
+type ElevationProvider interface {
+	Lookup(ctx context.Context, locations []geo.LatLng) ([]*float64, error)
+}
+
+// ElevationConfig selects and configures an ElevationProvider.
+type ElevationConfig struct {
+	Provider string
+	APIKey   string
+	// SRTMDir, SRTMCacheTiles and Fallback configure the srtm provider.
+	SRTMDir        string
+	SRTMCacheTiles int
+	Fallback       string
+}
+
+// NewElevationProvider creates the provider named by cfg.Provider.
+func NewElevationProvider(cfg ElevationConfig) (ElevationProvider, error) {
+	if cfg.Fallback != "" && !strings.EqualFold(cfg.Provider, ElevationSRTM) {
+		return nil, fmt.Errorf("elevation provider %q does not use a fallback, only %q does", cfg.Provider, ElevationSRTM)
+	}
+	switch strings.ToLower(cfg.Provider) {
+	case ElevationGoogle:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("elevation provider %q requires an api key", cfg.Provider)
+		}
+		mapsClient, err := NewMapsClient(cfg.APIKey)
+		if err != nil {
+			return nil, err
+		}
+		return &ChunkedElevation{
+			Provider:    &GoogleElevation{Client: mapsClient},
+			ChunkSize:   DefaultElevationChunkSize,
+			Concurrency: DefaultElevationConcurrency,
+		}, nil
+	case ElevationNone:
+		return NoElevation{}, nil
+	case ElevationFake:
+		return &FakeElevation{Elevation: DefaultFakeElevation}, nil
+	case ElevationSRTM:
+		if cfg.SRTMDir == "" {
+			return nil, fmt.Errorf("elevation provider %q requires a tile directory", cfg.Provider)
+		}
+		var fallback ElevationProvider
+		if cfg.Fallback != "" {
+			if strings.EqualFold(cfg.Fallback, ElevationSRTM) {
+				return nil, fmt.Errorf("elevation provider %q cannot fall back to itself", cfg.Provider)
+			}
+			var err error
+			if fallback, err = NewElevationProvider(ElevationConfig{Provider: cfg.Fallback, APIKey: cfg.APIKey}); err != nil {
+				return nil, errorx.Decorate(err, "failed to configure fallback elevation provider")
+			}
+		}
+		return NewSRTMElevation(cfg.SRTMDir, cfg.SRTMCacheTiles, fallback), nil
+	default:
+		return nil, fmt.Errorf("unknown elevation provider %q", cfg.Provider)
+	}
+}
+
+// ChunkedElevation splits lookups into chunks of at most ChunkSize locations and looks up to Concurrency chunks up at
+// once with Provider. When only some chunks fail the elevations of the successful chunks are returned together with a
+// *PartialElevationError.
+type ChunkedElevation struct {
+	Provider    ElevationProvider
+	ChunkSize   int
+	Concurrency int
+}
+
+// ElevationChunkError is the failure of the chunk of locations [Start, End).
+type ElevationChunkError struct {
+	Start int
+	End   int
+	Err   error
+}
+
+// PartialElevationError reports the chunks of a ChunkedElevation lookup that failed.
+type PartialElevationError struct {
+	Failures []ElevationChunkError
+}
+
+func (e *PartialElevationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to fetch elevation data for %d chunk(s)", len(e.Failures))
+	for _, f := range e.Failures {
+		fmt.Fprintf(&b, "; locations %d-%d: %s", f.Start, f.End-1, f.Err)
+	}
+	return b.String()
+}
+
+func (c *ChunkedElevation) Lookup(ctx context.Context, locations []geo.LatLng) ([]*float64, error) {
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 || chunkSize > MaxElevationLocations {
+		chunkSize = MaxElevationLocations
+	}
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	elevations := make([]*float64, len(locations))
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures []ElevationChunkError
+		sem      = make(chan struct{}, concurrency)
+	)
+	for start := 0; start < len(locations); start += chunkSize {
+		end := start + chunkSize
+		if end > len(locations) {
+			end = len(locations)
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(start, end int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			chunk, err := c.Provider.Lookup(ctx, locations[start:end])
+			if err != nil {
+				mu.Lock()
+				failures = append(failures, ElevationChunkError{Start: start, End: end, Err: err})
+				mu.Unlock()
+				return
+			}
+			copy(elevations[start:end], chunk)
+		}(start, end)
+	}
+	wg.Wait()
+
+	if len(failures) == 0 {
+		return elevations, nil
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Start < failures[j].Start })
+	chunks := (len(locations) + chunkSize - 1) / chunkSize
+	if len(failures) == chunks {
+		return nil, errorx.Decorate(failures[0].Err, "failed to fetch elevation data for every chunk")
+	}
+	return elevations, &PartialElevationError{Failures: failures}
+}
+
+// GoogleElevation looks up elevations with the Google Maps Elevation API. Requests are limited to
+// MaxElevationLocations, wrap it in a ChunkedElevation for longer routes.
+type GoogleElevation struct {
+	Client *maps.Client
+}
+
+func (g *GoogleElevation) Lookup(ctx context.Context, locations []geo.LatLng) ([]*float64, error) {
+	eleReq := &maps.ElevationRequest{}
+	for _, l := range locations {
+		eleReq.Locations = append(eleReq.Locations, maps.LatLng{Lat: l.Lat, Lng: l.Lng})
+	}
+
+	results, err := g.Client.Elevation(ctx, eleReq)
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed to fetch elevation data")
+	}
+
+	elevations := make([]*float64, len(locations))
+	for i := 0; i < len(results) && i < len(locations); i++ {
+		elevation := results[i].Elevation
+		elevations[i] = &elevation
+	}
+	return elevations, nil
+}
+
+// NoElevation never returns elevations, leaving tracks without elevation data.
+type NoElevation struct{}
+
+func (NoElevation) Lookup(_ context.Context, locations []geo.LatLng) ([]*float64, error) {
+	return make([]*float64, len(locations)), nil
+}
+
+// FakeElevation returns Elevation for every location, for use in tests.
+type FakeElevation struct {
+	Elevation float64
+}
+
+func (f *FakeElevation) Lookup(_ context.Context, locations []geo.LatLng) ([]*float64, error) {
+	elevations := make([]*float64, len(locations))
+	for i := range elevations {
+		elevation := f.Elevation
+		elevations[i] = &elevation
+	}
+	return elevations, nil
+}
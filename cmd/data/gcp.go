@@ -1,20 +1,24 @@
 package data
 
 import (
-	"bytes"
 	"cloud.google.com/go/storage"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/joomcode/errorx"
+	"google.golang.org/api/iterator"
 	"googlemaps.github.io/maps"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
+// uploadTimeout bounds an upload including its retries.
+const uploadTimeout = 50 * time.Second
+
 type GCP struct {
 	StorageClient *storage.Client
-	MapsClient    *maps.Client
 	AccessID      string
 	BucketID      string
 }
@@ -37,52 +41,126 @@ func NewMapsClient(apiKey string) (*maps.Client, error) {
 	return gClient, nil
 }
 
-// GetSignedUploadURL fetches a PUT url for an object.
-func (g *GCP) GetSignedUploadURL(obj string) (*string, error) {
-	url, err := g.StorageClient.Bucket(g.BucketID).SignedURL(obj, &storage.SignedURLOptions{
-		Scheme:         storage.SigningSchemeV4,
-		Method:         http.MethodPut,
-		Expires:        time.Now().Add(15 * time.Minute),
-		GoogleAccessID: g.AccessID,
-		ContentType:    "binary/octet-stream",
-	})
+// Put uploads body with StreamFileUpload.
+func (g *GCP) Put(ctx context.Context, obj Object, body []byte) error {
+	return g.StreamFileUpload(ctx, obj, body)
+}
 
+func (g *GCP) Get(ctx context.Context, key string) ([]byte, *Object, error) {
+	obj, err := g.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rc, err := g.StorageClient.Bucket(g.BucketID).Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, nil, ErrObjectNotFound
+	}
 	if err != nil {
-		return nil, errorx.Decorate(err, "failed to get upload URL. Bucket: %s", g.BucketID)
+		return nil, nil, errorx.Decorate(err, "failed to read object %s", key)
 	}
+	defer rc.Close()
 
-	return &url, nil
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, nil, errorx.Decorate(err, "failed to read object %s", key)
+	}
+	return body, obj, nil
 }
 
-// GetSignedDownloadURL fetches the given object string to a pre signed download URL.
-func (g *GCP) GetSignedDownloadURL(obj string) (*string, error) {
-	url, err := g.StorageClient.Bucket(g.BucketID).SignedURL(obj, &storage.SignedURLOptions{
-		Scheme:         storage.SigningSchemeV4,
-		Method:         http.MethodGet,
-		Expires:        time.Now().Add(15 * time.Minute),
-		GoogleAccessID: g.AccessID,
+// SignedURL returns a pre signed download URL. The download is served with the content type and disposition of obj,
+// whatever metadata the object was stored with.
+func (g *GCP) SignedURL(_ context.Context, obj Object, expires time.Duration) (string, error) {
+	query := url.Values{}
+	if obj.ContentType != "" {
+		query.Set("response-content-type", obj.ContentType)
+	}
+	if obj.ContentDisposition != "" {
+		query.Set("response-content-disposition", obj.ContentDisposition)
+	}
+
+	signed, err := g.StorageClient.Bucket(g.BucketID).SignedURL(obj.Key, &storage.SignedURLOptions{
+		Scheme:          storage.SigningSchemeV4,
+		Method:          http.MethodGet,
+		Expires:         time.Now().Add(expires),
+		GoogleAccessID:  g.AccessID,
+		QueryParameters: query,
 	})
+	if err != nil {
+		return "", errorx.Decorate(err, "failed to get signed download URL. Bucket: %s ", g.BucketID)
+	}
+	return signed, nil
+}
 
+func (g *GCP) Delete(ctx context.Context, key string) error {
+	err := g.StorageClient.Bucket(g.BucketID).Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ErrObjectNotFound
+	}
 	if err != nil {
-		return nil, errorx.Decorate(err, "failed to get signed download URL. Bucket: %s ", g.BucketID)
+		return errorx.Decorate(err, "failed to delete object %s", key)
 	}
-	return &url, nil
+	return nil
 }
 
-func (g *GCP) StreamFileUpload(parent context.Context, object string, payload []byte) error {
-	buf := bytes.NewBuffer(payload)
+func (g *GCP) Stat(ctx context.Context, key string) (*Object, error) {
+	attrs, err := g.StorageClient.Bucket(g.BucketID).Object(key).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed to stat object %s", key)
+	}
+	return &Object{
+		Key:                attrs.Name,
+		ContentType:        attrs.ContentType,
+		ContentDisposition: attrs.ContentDisposition,
+		CacheControl:       attrs.CacheControl,
+		Metadata:           attrs.Metadata,
+		Size:               attrs.Size,
+		Created:            attrs.Created,
+	}, nil
+}
+
+func (g *GCP) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	it := g.StorageClient.Bucket(g.BucketID).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return errorx.Decorate(err, "failed to list objects. Bucket: %s", g.BucketID)
+		}
+		if err := fn(Object{Key: attrs.Name, ContentType: attrs.ContentType, Size: attrs.Size, Created: attrs.Created}); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *GCP) Close() error {
+	return g.StorageClient.Close()
+}
 
-	ctx, cancel := context.WithTimeout(parent, time.Second*50)
+// StreamFileUpload writes payload to the object along with its metadata. The payload is sent as a single buffered
+// chunk so that transient failures are retried until the upload succeeds, ctx is cancelled or uploadTimeout passes.
+func (g *GCP) StreamFileUpload(parent context.Context, obj Object, payload []byte) error {
+	ctx, cancel := context.WithTimeout(parent, uploadTimeout)
 	defer cancel()
 
-	wc := g.StorageClient.Bucket(g.BucketID).Object(object).NewWriter(ctx)
-	wc.ChunkSize = 0
+	// Every attempt rewrites the whole object, so retrying the non idempotent write is safe.
+	handle := g.StorageClient.Bucket(g.BucketID).Object(obj.Key).Retryer(storage.WithPolicy(storage.RetryAlways))
+	wc := handle.NewWriter(ctx)
+	wc.ContentType = obj.ContentType
+	wc.ContentDisposition = obj.ContentDisposition
+	wc.CacheControl = obj.CacheControl
+	wc.Metadata = obj.Metadata
 
-	if _, err := io.Copy(wc, buf); err != nil {
-		return errorx.Decorate(err, "failed to copy buffer")
+	if _, err := wc.Write(payload); err != nil {
+		return errorx.Decorate(err, "failed to write object %s", obj.Key)
 	}
 	if err := wc.Close(); err != nil {
-		return errorx.Decorate(err, "failed to close Writer.Closer")
+		return errorx.Decorate(err, "failed to upload object %s. Bucket: %s", obj.Key, g.BucketID)
 	}
 
 	return nil
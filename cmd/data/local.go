@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/joomcode/errorx"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrURLExpired       = errors.New("url expired")
+)
+
+// LocalStorage stores files in a directory and signs download URLs with an HMAC of Secret, to be served by the API
+// itself. Bodies are kept under Dir/objects and their attributes as JSON under Dir/attrs.
+type LocalStorage struct {
+	Dir string
+	// BaseURL is the URL of the download route, keys are appended to it.
+	BaseURL string
+	Secret  []byte
+}
+
+// NewLocalStorage creates the directories of a LocalStorage rooted at dir.
+func NewLocalStorage(dir, baseURL string, secret []byte) (*LocalStorage, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("local storage requires a signing secret")
+	}
+	l := &LocalStorage{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/"), Secret: secret}
+	for _, sub := range []string{"objects", "attrs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, errorx.Decorate(err, "failed to create storage directory")
+		}
+	}
+	return l, nil
+}
+
+func (l *LocalStorage) Put(_ context.Context, obj Object, body []byte) error {
+	objectPath, attrsPath, err := l.paths(obj.Key)
+	if err != nil {
+		return err
+	}
+
+	obj.Size = int64(len(body))
+	obj.Created = time.Now().UTC()
+	attrs, err := json.Marshal(obj)
+	if err != nil {
+		return errorx.Decorate(err, "failed to marshal object attributes")
+	}
+	// The attributes are written last, an object without them is not visible yet.
+	if err := writeFileAtomic(objectPath, body); err != nil {
+		return err
+	}
+	return writeFileAtomic(attrsPath, attrs)
+}
+
+func (l *LocalStorage) Get(ctx context.Context, key string) ([]byte, *Object, error) {
+	obj, err := l.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	objectPath, _, _ := l.paths(key)
+	body, err := os.ReadFile(objectPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, nil, errorx.Decorate(err, "failed to read object %s", key)
+	}
+	return body, obj, nil
+}
+
+// SignedURL returns a download URL below BaseURL. The expiry, content type and disposition are part of the signed
+// query so they cannot be changed without invalidating the URL.
+func (l *LocalStorage) SignedURL(_ context.Context, obj Object, expires time.Duration) (string, error) {
+	if _, _, err := l.paths(obj.Key); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(time.Now().Add(expires).Unix(), 10))
+	if obj.ContentType != "" {
+		query.Set("type", obj.ContentType)
+	}
+	if obj.ContentDisposition != "" {
+		query.Set("disposition", obj.ContentDisposition)
+	}
+	query.Set("signature", l.sign(obj.Key, query))
+
+	segments := strings.Split(obj.Key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return l.BaseURL + "/" + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+// Verify checks the query of a URL returned by SignedURL for key, and returns the object with the content type and
+// disposition the download should be served with.
+func (l *LocalStorage) Verify(key string, query url.Values, now time.Time) (*Object, error) {
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(l.sign(key, query))) {
+		return nil, ErrInvalidSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return nil, ErrURLExpired
+	}
+	return &Object{Key: key, ContentType: query.Get("type"), ContentDisposition: query.Get("disposition")}, nil
+}
+
+func (l *LocalStorage) Delete(_ context.Context, key string) error {
+	objectPath, attrsPath, err := l.paths(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(attrsPath); errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	} else if err != nil {
+		return errorx.Decorate(err, "failed to delete object %s", key)
+	}
+	if err := os.Remove(objectPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errorx.Decorate(err, "failed to delete object %s", key)
+	}
+	return nil
+}
+
+func (l *LocalStorage) Stat(_ context.Context, key string) (*Object, error) {
+	_, attrsPath, err := l.paths(key)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := os.ReadFile(attrsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed to stat object %s", key)
+	}
+
+	var obj Object
+	if err := json.Unmarshal(attrs, &obj); err != nil {
+		return nil, errorx.Decorate(err, "failed to unmarshal attributes of object %s", key)
+	}
+	return &obj, nil
+}
+
+func (l *LocalStorage) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	root := filepath.Join(l.Dir, "attrs")
+	// Only the directory holding the prefix is walked, keys in it are matched against the rest of the prefix.
+	dir := root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = filepath.Join(root, filepath.FromSlash(prefix[:i]))
+	}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == dir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") || !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(filepath.ToSlash(rel), ".json")
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		obj, err := l.Stat(ctx, key)
+		if errors.Is(err, ErrObjectNotFound) {
+			// Deleted while listing.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(*obj)
+	})
+	if err != nil {
+		return errorx.Decorate(err, "failed to list objects")
+	}
+	return nil
+}
+
+// paths returns the file paths of the body and attributes of key, rejecting keys that would escape Dir.
+func (l *LocalStorage) paths(key string) (string, string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", "", fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(l.Dir, "objects", filepath.FromSlash(key)),
+		filepath.Join(l.Dir, "attrs", filepath.FromSlash(key)+".json"), nil
+}
+
+// sign returns the HMAC of key and the expiry, content type and disposition in query.
+func (l *LocalStorage) sign(key string, query url.Values) string {
+	mac := hmac.New(sha256.New, l.Secret)
+	for _, v := range []string{key, query.Get("expires"), query.Get("type"), query.Get("disposition")} {
+		mac.Write([]byte(v))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it into place, so that readers never see
+// a partially written file.
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return errorx.Decorate(err, "failed to create directory for %s", name)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return errorx.Decorate(err, "failed to create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errorx.Decorate(err, "failed to write %s", name)
+	}
+	if err := tmp.Close(); err != nil {
+		return errorx.Decorate(err, "failed to write %s", name)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return errorx.Decorate(err, "failed to write %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PurgeExpired deletes the objects under prefix created before cutoff and returns how many were deleted. Objects that
+// disappear while purging are not counted as failures.
+func PurgeExpired(ctx context.Context, s Storage, prefix string, cutoff time.Time) (int, error) {
+	var expired []string
+	err := s.List(ctx, prefix, func(obj Object) error {
+		if obj.Created.Before(cutoff) {
+			expired = append(expired, obj.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, key := range expired {
+		if err := s.Delete(ctx, key); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,168 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"github.com/joomcode/errorx"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3 stores files in a bucket of Amazon S3 or an S3 compatible service such as MinIO.
+type S3 struct {
+	Client   *minio.Client
+	BucketID string
+}
+
+// S3Config configures the s3 storage backend.
+type S3Config struct {
+	// Endpoint is the host and optional port of the service, s3.amazonaws.com by default.
+	Endpoint string
+	Region   string
+	// AccessKeyID and SecretAccessKey are the static credentials to use. Without them credentials are taken from the
+	// AWS environment variables, the shared credentials file or the instance's IAM role.
+	AccessKeyID     string
+	SecretAccessKey string
+	// Insecure connects over plain HTTP, e.g. to a local MinIO.
+	Insecure bool
+}
+
+// NewS3Client creates a client for the service described by cfg.
+func NewS3Client(cfg S3Config) (*minio.Client, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	creds := credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	if cfg.AccessKeyID == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed to create s3 client")
+	}
+	return client, nil
+}
+
+func (s *S3) Put(ctx context.Context, obj Object, body []byte) error {
+	_, err := s.Client.PutObject(ctx, s.BucketID, obj.Key, bytes.NewReader(body), int64(len(body)), minio.PutObjectOptions{
+		ContentType:        obj.ContentType,
+		ContentDisposition: obj.ContentDisposition,
+		CacheControl:       obj.CacheControl,
+		UserMetadata:       obj.Metadata,
+	})
+	if err != nil {
+		return errorx.Decorate(err, "failed to upload object %s. Bucket: %s", obj.Key, s.BucketID)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, *Object, error) {
+	obj, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := s.Client.GetObject(ctx, s.BucketID, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err, "failed to read object %s", key)
+	}
+	defer reader.Close()
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, s3Error(err, "failed to read object %s", key)
+	}
+	return body, obj, nil
+}
+
+// SignedURL returns a presigned GET URL. The download is served with the content type and disposition of obj,
+// whatever metadata the object was stored with.
+func (s *S3) SignedURL(ctx context.Context, obj Object, expires time.Duration) (string, error) {
+	query := url.Values{}
+	if obj.ContentType != "" {
+		query.Set("response-content-type", obj.ContentType)
+	}
+	if obj.ContentDisposition != "" {
+		query.Set("response-content-disposition", obj.ContentDisposition)
+	}
+
+	signed, err := s.Client.PresignedGetObject(ctx, s.BucketID, obj.Key, expires, query)
+	if err != nil {
+		return "", errorx.Decorate(err, "failed to get presigned download URL. Bucket: %s", s.BucketID)
+	}
+	return signed.String(), nil
+}
+
+// Delete removes the object. S3 does not report deletes of missing keys, so the object is looked up first.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+	if err := s.Client.RemoveObject(ctx, s.BucketID, key, minio.RemoveObjectOptions{}); err != nil {
+		return s3Error(err, "failed to delete object %s", key)
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*Object, error) {
+	info, err := s.Client.StatObject(ctx, s.BucketID, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err, "failed to stat object %s", key)
+	}
+	// S3 returns the metadata keys canonicalized as headers, they are stored lower case.
+	var metadata map[string]string
+	for k, v := range info.UserMetadata {
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[strings.ToLower(k)] = v
+	}
+	return &Object{
+		Key:                info.Key,
+		ContentType:        info.ContentType,
+		ContentDisposition: info.Metadata.Get("Content-Disposition"),
+		CacheControl:       info.Metadata.Get("Cache-Control"),
+		Metadata:           metadata,
+		Size:               info.Size,
+		Created:            info.LastModified,
+	}, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	// Cancelling stops the listing when fn fails part way.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for info := range s.Client.ListObjects(ctx, s.BucketID, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return errorx.Decorate(info.Err, "failed to list objects. Bucket: %s", s.BucketID)
+		}
+		if err := fn(Object{Key: info.Key, Size: info.Size, Created: info.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3Error returns ErrObjectNotFound for missing keys and decorates any other error.
+func s3Error(err error, message string, args ...any) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	return errorx.Decorate(err, message, args...)
+}
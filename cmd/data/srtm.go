@@ -0,0 +1,226 @@
+package data
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/joomcode/errorx"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DefaultSRTMCacheTiles is the number of open tiles kept by SRTMElevation when no size is configured.
+	DefaultSRTMCacheTiles = 16
+
+	srtm1Samples = 3601
+	srtm3Samples = 1201
+	srtmVoid     = -32768
+)
+
+// SRTMElevation looks up elevations from SRTM .hgt tiles (1 or 3 arc-second) stored in Dir, e.g. Dir/N47W053.hgt.
+// Elevations are bilinearly interpolated between the four surrounding samples. Locations without a tile, or with only
+// void samples, are looked up with Fallback when it is set.
+type SRTMElevation struct {
+	Dir      string
+	Fallback ElevationProvider
+
+	mu       sync.Mutex
+	maxTiles int
+	tiles    map[string]*list.Element
+	lru      *list.List
+}
+
+type srtmTile struct {
+	name    string
+	file    *os.File
+	samples int
+}
+
+func NewSRTMElevation(dir string, maxTiles int, fallback ElevationProvider) *SRTMElevation {
+	if maxTiles <= 0 {
+		maxTiles = DefaultSRTMCacheTiles
+	}
+	return &SRTMElevation{
+		Dir:      dir,
+		Fallback: fallback,
+		maxTiles: maxTiles,
+		tiles:    map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// Lookup reads the elevations from the tiles and looks up the locations without a tile with the fallback. When the
+// fallback fails the elevations found so far are returned along with its error.
+func (s *SRTMElevation) Lookup(ctx context.Context, locations []geo.LatLng) ([]*float64, error) {
+	elevations := make([]*float64, len(locations))
+	var missing []int
+	for i, l := range locations {
+		elevation, err := s.elevation(l)
+		if err != nil {
+			return nil, err
+		}
+		if elevation == nil {
+			missing = append(missing, i)
+			continue
+		}
+		elevations[i] = elevation
+	}
+
+	if len(missing) == 0 || s.Fallback == nil {
+		return elevations, nil
+	}
+
+	fallbackLocations := make([]geo.LatLng, len(missing))
+	for i, idx := range missing {
+		fallbackLocations[i] = locations[idx]
+	}
+	// A failing fallback may still have returned part of the elevations, such as those of its successful chunks.
+	fallback, err := s.Fallback.Lookup(ctx, fallbackLocations)
+	for i, elevation := range fallback {
+		elevations[missing[i]] = elevation
+	}
+	if err != nil {
+		return elevations, errorx.Decorate(err, "failed to fetch fallback elevation data")
+	}
+
+	return elevations, nil
+}
+
+// Close closes every open tile.
+func (s *SRTMElevation) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var closeErr error
+	for s.lru.Len() > 0 {
+		if err := s.evict(s.lru.Back()); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// elevation returns the interpolated elevation at l, or nil when there is no tile or only void samples around l.
+func (s *SRTMElevation) elevation(l geo.LatLng) (*float64, error) {
+	latBase, lngBase := math.Floor(l.Lat), math.Floor(l.Lng)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tile, err := s.tile(srtmTileName(latBase, lngBase))
+	if err != nil || tile == nil {
+		return nil, err
+	}
+
+	// Rows run north to south and columns west to east, the first sample is the north west corner.
+	last := float64(tile.samples - 1)
+	row := (latBase + 1 - l.Lat) * last
+	col := (l.Lng - lngBase) * last
+	r0, c0 := int(math.Min(math.Floor(row), last-1)), int(math.Min(math.Floor(col), last-1))
+	dr, dc := row-float64(r0), col-float64(c0)
+
+	var samples [4]int16
+	for i, rc := range [4][2]int{{r0, c0}, {r0, c0 + 1}, {r0 + 1, c0}, {r0 + 1, c0 + 1}} {
+		if samples[i], err = tile.sample(rc[0], rc[1]); err != nil {
+			return nil, err
+		}
+	}
+	weights := [4]float64{(1 - dr) * (1 - dc), (1 - dr) * dc, dr * (1 - dc), dr * dc}
+
+	// Void samples are left out and the remaining weights renormalised.
+	var sum, weight float64
+	for i, sample := range samples {
+		if sample == srtmVoid {
+			continue
+		}
+		sum += float64(sample) * weights[i]
+		weight += weights[i]
+	}
+	if weight == 0 {
+		return nil, nil
+	}
+	elevation := sum / weight
+	return &elevation, nil
+}
+
+// tile returns the open tile for name, or nil when the tile does not exist. Callers must hold s.mu.
+func (s *SRTMElevation) tile(name string) (*srtmTile, error) {
+	if el, ok := s.tiles[name]; ok {
+		s.lru.MoveToFront(el)
+		return el.Value.(*srtmTile), nil
+	}
+
+	tile := &srtmTile{name: name}
+	f, err := os.Open(filepath.Join(s.Dir, name+".hgt"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, errorx.Decorate(err, "failed to open SRTM tile %s", name)
+	}
+	if err == nil {
+		info, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, errorx.Decorate(err, "failed to stat SRTM tile %s", name)
+		}
+		switch info.Size() {
+		case 2 * srtm1Samples * srtm1Samples:
+			tile.samples = srtm1Samples
+		case 2 * srtm3Samples * srtm3Samples:
+			tile.samples = srtm3Samples
+		default:
+			_ = f.Close()
+			return nil, fmt.Errorf("SRTM tile %s has unexpected size %d", name, info.Size())
+		}
+		tile.file = f
+	}
+
+	s.tiles[name] = s.lru.PushFront(tile)
+	for s.lru.Len() > s.maxTiles {
+		if err := s.evict(s.lru.Back()); err != nil {
+			return nil, err
+		}
+	}
+
+	if tile.file == nil {
+		return nil, nil
+	}
+	return tile, nil
+}
+
+func (s *SRTMElevation) evict(el *list.Element) error {
+	tile := s.lru.Remove(el).(*srtmTile)
+	delete(s.tiles, tile.name)
+	if tile.file == nil {
+		return nil
+	}
+	if err := tile.file.Close(); err != nil {
+		return errorx.Decorate(err, "failed to close SRTM tile %s", tile.name)
+	}
+	return nil
+}
+
+func (t *srtmTile) sample(row, col int) (int16, error) {
+	var b [2]byte
+	if _, err := t.file.ReadAt(b[:], int64(2*(row*t.samples+col))); err != nil {
+		return 0, errorx.Decorate(err, "failed to read SRTM tile %s", t.name)
+	}
+	return int16(binary.BigEndian.Uint16(b[:])), nil
+}
+
+// srtmTileName returns the name of the tile whose south west corner is at lat, lng, e.g. N47W053.
+func srtmTileName(lat, lng float64) string {
+	ns, ew := 'N', 'E'
+	if lat < 0 {
+		ns, lat = 'S', -lat
+	}
+	if lng < 0 {
+		ew, lng = 'W', -lng
+	}
+	return fmt.Sprintf("%c%02d%c%03d", ns, int(lat), ew, int(lng))
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	StorageGCS   = "gcs"
+	StorageLocal = "local"
+	StorageS3    = "s3"
+
+	// DefaultURLExpiry is how long signed download URLs stay valid.
+	DefaultURLExpiry = 15 * time.Minute
+	// DefaultCacheControl lets browsers keep downloads, an object is never rewritten with other contents.
+	DefaultCacheControl = "private, max-age=86400, immutable"
+
+	// ConversionPrefix is the key prefix converted files are stored under, the only objects expired conversions are
+	// purged from.
+	ConversionPrefix = "conversions/"
+)
+
+var (
+	// ErrObjectNotFound is returned by a Storage for keys it does not hold.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrInvalidKey is returned by a Storage for keys it cannot store objects under.
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object describes a stored file. ContentType, ContentDisposition and CacheControl are the headers the file is
+// downloaded with, Metadata is kept with the file as custom metadata.
+type Object struct {
+	Key                string            `json:"key"`
+	ContentType        string            `json:"contentType,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Size               int64             `json:"size"`
+	Created            time.Time         `json:"created"`
+}
+
+// Storage stores converted files and hands out expiring URLs to download them.
+type Storage interface {
+	// Put stores body under obj.Key along with its content type and disposition, replacing any existing object.
+	Put(ctx context.Context, obj Object, body []byte) error
+	Get(ctx context.Context, key string) ([]byte, *Object, error)
+	// SignedURL returns a URL that downloads obj.Key with the content type and disposition of obj until expires has
+	// passed.
+	SignedURL(ctx context.Context, obj Object, expires time.Duration) (string, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*Object, error)
+	// List calls fn for every stored object whose key starts with prefix, stopping at the first error fn returns.
+	// Listed objects may lack the download headers and metadata.
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+}
+
+// StorageConfig selects and configures a Storage.
+type StorageConfig struct {
+	Backend string
+	// BucketID configures the gcs and s3 backends, AccessID the gcs and S3 the s3 backend.
+	BucketID string
+	AccessID string
+	S3       S3Config
+	// Dir, BaseURL and Secret configure the local backend, see NewLocalStorage.
+	Dir     string
+	BaseURL string
+	Secret  []byte
+}
+
+// NewStorage creates the storage named by cfg.Backend.
+func NewStorage(ctx context.Context, cfg StorageConfig) (Storage, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case StorageGCS:
+		if cfg.BucketID == "" {
+			return nil, fmt.Errorf("storage backend %q requires a bucket", cfg.Backend)
+		}
+		storageClient, err := NewStorageClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &GCP{StorageClient: storageClient, AccessID: cfg.AccessID, BucketID: cfg.BucketID}, nil
+	case StorageS3:
+		if cfg.BucketID == "" {
+			return nil, fmt.Errorf("storage backend %q requires a bucket", cfg.Backend)
+		}
+		client, err := NewS3Client(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		return &S3{Client: client, BucketID: cfg.BucketID}, nil
+	case StorageLocal:
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("storage backend %q requires a directory", cfg.Backend)
+		}
+		return NewLocalStorage(cfg.Dir, cfg.BaseURL, cfg.Secret)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
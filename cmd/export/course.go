@@ -0,0 +1,102 @@
+package export
+
+import (
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// CourseSpeed is the speed in m/s used to time course points that have no timestamp, as course formats require
+	// one on every point.
+	CourseSpeed = 10 / 3.6
+	// TurnAngle is the change of heading in degrees at which a left or right course point is added.
+	TurnAngle = 45.0
+)
+
+// Course point types, named after their TCX PointType.
+const (
+	coursePointGeneric = "Generic"
+	coursePointLeft    = "Left"
+	coursePointRight   = "Right"
+)
+
+// coursePoint is a turn or waypoint along a course. Index is the track point it is at or nearest to.
+type coursePoint struct {
+	geo.LatLng
+	Elevation *float64
+	Index     int
+	Type      string
+	Name      string
+	Notes     string
+}
+
+// courseTimes returns the timestamp of each point, timing points without one at CourseSpeed from the last point with
+// a timestamp. Times are computed from the distance covered since that point so truncation errors do not add up.
+func courseTimes(t *Track, distances []float64) []time.Time {
+	times := make([]time.Time, len(t.Points))
+	var anchor time.Time
+	anchorIndex := 0
+	for i, p := range t.Points {
+		switch {
+		case p.Time != nil:
+			times[i] = p.Time.UTC()
+			anchor, anchorIndex = times[i], i
+		case i == 0:
+			times[i] = t.Time.UTC()
+			anchor = times[i]
+		default:
+			seconds := (distances[i] - distances[anchorIndex]) / CourseSpeed
+			times[i] = anchor.Add(time.Duration(seconds * float64(time.Second))).Truncate(time.Millisecond)
+		}
+	}
+	return times
+}
+
+// coursePoints returns a left or right course point for every change of heading of at least TurnAngle and a generic
+// course point per waypoint, in course order.
+func coursePoints(t *Track) []coursePoint {
+	var points []coursePoint
+	for i := 1; i < len(t.Points)-1; i++ {
+		in := geo.Bearing(t.Points[i-1].LatLng, t.Points[i].LatLng)
+		out := geo.Bearing(t.Points[i].LatLng, t.Points[i+1].LatLng)
+		turn := math.Mod(out-in+540, 360) - 180
+		if math.Abs(turn) < TurnAngle {
+			continue
+		}
+		pointType := coursePointRight
+		if turn < 0 {
+			pointType = coursePointLeft
+		}
+		points = append(points, coursePoint{
+			LatLng:    t.Points[i].LatLng,
+			Elevation: t.Points[i].Elevation,
+			Index:     i,
+			Type:      pointType,
+			Name:      pointType,
+		})
+	}
+
+	for _, w := range t.Waypoints {
+		points = append(points, coursePoint{
+			LatLng:    w.LatLng,
+			Elevation: w.Elevation,
+			Index:     geo.Nearest(t.Points, w.LatLng),
+			Type:      coursePointGeneric,
+			Name:      w.Name,
+			Notes:     w.Description,
+		})
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Index < points[j].Index })
+
+	return points
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length])
+}
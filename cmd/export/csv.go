@@ -0,0 +1,64 @@
+package export
+
+import (
+	"encoding/csv"
+	"github.com/joomcode/errorx"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"io"
+	"strconv"
+)
+
+const (
+	CSVContentType = "text/csv"
+	TSVContentType = "text/tab-separated-values"
+)
+
+var tableHeader = []string{"lat", "lon", "elevation", "distance", "segment_distance", "grade"}
+
+// EncodeCSV writes one comma separated row per track point, see encodeTable.
+func EncodeCSV(w io.Writer, t *Track) error {
+	return encodeTable(w, t, ',')
+}
+
+// EncodeTSV writes one tab separated row per track point, see encodeTable.
+func EncodeTSV(w io.Writer, t *Track) error {
+	return encodeTable(w, t, '\t')
+}
+
+// encodeTable writes a header and a row per track point with its elevation, the cumulative and segment distance in
+// meters and the grade in percent from the previous point. Unknown elevations and grades are left empty.
+func encodeTable(w io.Writer, t *Track, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(tableHeader); err != nil {
+		return errorx.Decorate(err, "failed to write table header")
+	}
+
+	distances := geo.CumulativeDistances(t.Points)
+	for i, p := range t.Points {
+		row := []string{formatFloat(p.Lat), formatFloat(p.Lng), "", formatFloat(distances[i]), "0", ""}
+		if p.Elevation != nil {
+			row[2] = formatFloat(*p.Elevation)
+		}
+		if i > 0 {
+			segment := distances[i] - distances[i-1]
+			row[4] = formatFloat(segment)
+			if prev := t.Points[i-1].Elevation; p.Elevation != nil && prev != nil && segment > 0 {
+				row[5] = strconv.FormatFloat((*p.Elevation-*prev)/segment*100, 'f', 2, 64)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return errorx.Decorate(err, "failed to write table row")
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return errorx.Decorate(err, "failed to flush table")
+	}
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
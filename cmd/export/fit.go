@@ -0,0 +1,249 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/joomcode/errorx"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+const FITContentType = "application/vnd.ant.fit"
+
+const (
+	fitHeaderSize      = 14
+	fitProtocolVersion = 0x10
+	fitProfileVersion  = 2140
+	fitNameSize        = 16
+
+	fitFileCourse              = 6
+	fitManufacturerDevelopment = 255
+	fitEventTimer              = 0
+	fitEventTypeStart          = 0
+	fitEventTypeStopDisableAll = 9
+)
+
+// fitEpoch is the start of FIT date_time values.
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// FIT base types.
+const (
+	fitEnum    byte = 0x00
+	fitUint8   byte = 0x02
+	fitUint16  byte = 0x84
+	fitSint32  byte = 0x85
+	fitUint32  byte = 0x86
+	fitString  byte = 0x07
+	fitUint32z byte = 0x8C
+)
+
+type fitField struct {
+	num      byte
+	size     byte
+	baseType byte
+}
+
+type fitMessage struct {
+	local  byte
+	global uint16
+	fields []fitField
+}
+
+var (
+	fitFileIDMessage = fitMessage{local: 0, global: 0, fields: []fitField{
+		{num: 0, size: 1, baseType: fitEnum},    // type
+		{num: 1, size: 2, baseType: fitUint16},  // manufacturer
+		{num: 2, size: 2, baseType: fitUint16},  // product
+		{num: 3, size: 4, baseType: fitUint32z}, // serial_number
+		{num: 4, size: 4, baseType: fitUint32},  // time_created
+	}}
+	fitCourseMessage = fitMessage{local: 1, global: 31, fields: []fitField{
+		{num: 4, size: 1, baseType: fitEnum},             // sport
+		{num: 5, size: fitNameSize, baseType: fitString}, // name
+	}}
+	fitLapMessage = fitMessage{local: 2, global: 19, fields: []fitField{
+		{num: 254, size: 2, baseType: fitUint16}, // message_index
+		{num: 253, size: 4, baseType: fitUint32}, // timestamp
+		{num: 2, size: 4, baseType: fitUint32},   // start_time
+		{num: 3, size: 4, baseType: fitSint32},   // start_position_lat
+		{num: 4, size: 4, baseType: fitSint32},   // start_position_long
+		{num: 5, size: 4, baseType: fitSint32},   // end_position_lat
+		{num: 6, size: 4, baseType: fitSint32},   // end_position_long
+		{num: 7, size: 4, baseType: fitUint32},   // total_elapsed_time
+		{num: 8, size: 4, baseType: fitUint32},   // total_timer_time
+		{num: 9, size: 4, baseType: fitUint32},   // total_distance
+		{num: 21, size: 2, baseType: fitUint16},  // total_ascent
+		{num: 22, size: 2, baseType: fitUint16},  // total_descent
+	}}
+	fitEventMessage = fitMessage{local: 3, global: 21, fields: []fitField{
+		{num: 253, size: 4, baseType: fitUint32}, // timestamp
+		{num: 0, size: 1, baseType: fitEnum},     // event
+		{num: 1, size: 1, baseType: fitEnum},     // event_type
+		{num: 4, size: 1, baseType: fitUint8},    // event_group
+	}}
+	fitRecordMessage = fitMessage{local: 4, global: 20, fields: []fitField{
+		{num: 253, size: 4, baseType: fitUint32}, // timestamp
+		{num: 0, size: 4, baseType: fitSint32},   // position_lat
+		{num: 1, size: 4, baseType: fitSint32},   // position_long
+		{num: 2, size: 2, baseType: fitUint16},   // altitude
+		{num: 5, size: 4, baseType: fitUint32},   // distance
+	}}
+	fitCoursePointMessage = fitMessage{local: 5, global: 32, fields: []fitField{
+		{num: 254, size: 2, baseType: fitUint16},         // message_index
+		{num: 1, size: 4, baseType: fitUint32},           // timestamp
+		{num: 2, size: 4, baseType: fitSint32},           // position_lat
+		{num: 3, size: 4, baseType: fitSint32},           // position_long
+		{num: 4, size: 4, baseType: fitUint32},           // distance
+		{num: 5, size: 1, baseType: fitEnum},             // type
+		{num: 6, size: fitNameSize, baseType: fitString}, // name
+	}}
+)
+
+// fitCoursePointTypes maps course point types to the FIT course_point enum.
+var fitCoursePointTypes = map[string]byte{
+	coursePointGeneric: 0,
+	coursePointLeft:    6,
+	coursePointRight:   7,
+}
+
+// fitEncoder buffers the data records of a FIT file.
+type fitEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *fitEncoder) define(m fitMessage) {
+	e.buf.WriteByte(0x40 | m.local)
+	e.buf.WriteByte(0) // reserved
+	e.buf.WriteByte(0) // little endian
+	_ = binary.Write(&e.buf, binary.LittleEndian, m.global)
+	e.buf.WriteByte(byte(len(m.fields)))
+	for _, f := range m.fields {
+		e.buf.Write([]byte{f.num, f.size, f.baseType})
+	}
+}
+
+// write writes a data message, values must match the message fields in order and size.
+func (e *fitEncoder) write(m fitMessage, values ...any) {
+	e.buf.WriteByte(m.local)
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			name := make([]byte, m.fields[i].size)
+			copy(name, fitName(s, len(name)-1))
+			e.buf.Write(name)
+			continue
+		}
+		_ = binary.Write(&e.buf, binary.LittleEndian, v)
+	}
+}
+
+// fitName cuts s to at most size bytes without splitting a UTF-8 sequence.
+func fitName(s string, size int) string {
+	for len(s) > size {
+		_, n := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-n]
+	}
+	return s
+}
+
+func fitTime(t time.Time) uint32 {
+	return uint32(t.Sub(fitEpoch) / time.Second)
+}
+
+func fitSemicircles(degrees float64) int32 {
+	return int32(math.Round(degrees * (1 << 31) / 180))
+}
+
+func fitDistance(meters float64) uint32 {
+	return uint32(math.Round(meters * 100))
+}
+
+func fitAltitude(elevation *float64) uint16 {
+	if elevation == nil {
+		return math.MaxUint16
+	}
+	return uint16(math.Max(0, math.Min(math.MaxUint16-1, math.Round((*elevation+500)*5))))
+}
+
+func fitElapsed(d time.Duration) uint32 {
+	return uint32(d.Milliseconds())
+}
+
+// EncodeFIT writes the track as a FIT course file with file_id, course, lap, event, record and course_point messages.
+// Points without a timestamp are timed at CourseSpeed from the track time.
+func EncodeFIT(w io.Writer, t *Track) error {
+	if len(t.Points) == 0 {
+		return errorx.IllegalArgument.New("fit course needs at least one point")
+	}
+
+	distances := geo.CumulativeDistances(t.Points)
+	times := courseTimes(t, distances)
+	first, last := 0, len(t.Points)-1
+	start, end := t.Points[first].LatLng, t.Points[last].LatLng
+	gain, loss := geo.ElevationGain(t.Points)
+
+	name := t.Name
+	if name == "" {
+		name = Creator
+	}
+
+	e := &fitEncoder{}
+	for _, m := range []fitMessage{fitFileIDMessage, fitCourseMessage, fitLapMessage, fitEventMessage, fitRecordMessage, fitCoursePointMessage} {
+		e.define(m)
+	}
+	e.write(fitFileIDMessage, byte(fitFileCourse), uint16(fitManufacturerDevelopment), uint16(0), uint32(t.RouteID), fitTime(t.Time))
+	e.write(fitCourseMessage, byte(0), name)
+	e.write(fitLapMessage, uint16(0), fitTime(times[last]), fitTime(times[first]),
+		fitSemicircles(start.Lat), fitSemicircles(start.Lng), fitSemicircles(end.Lat), fitSemicircles(end.Lng),
+		fitElapsed(times[last].Sub(times[first])), fitElapsed(times[last].Sub(times[first])), fitDistance(distances[last]),
+		uint16(math.Min(math.Round(gain), math.MaxUint16-1)), uint16(math.Min(math.Round(loss), math.MaxUint16-1)))
+	e.write(fitEventMessage, fitTime(times[first]), byte(fitEventTimer), byte(fitEventTypeStart), uint8(0))
+	for i, p := range t.Points {
+		e.write(fitRecordMessage, fitTime(times[i]), fitSemicircles(p.Lat), fitSemicircles(p.Lng), fitAltitude(p.Elevation), fitDistance(distances[i]))
+	}
+	for i, p := range coursePoints(t) {
+		e.write(fitCoursePointMessage, uint16(i), fitTime(times[p.Index]), fitSemicircles(p.Lat), fitSemicircles(p.Lng),
+			fitDistance(distances[p.Index]), fitCoursePointTypes[p.Type], p.Name)
+	}
+	e.write(fitEventMessage, fitTime(times[last]), byte(fitEventTimer), byte(fitEventTypeStopDisableAll), uint8(0))
+
+	header := make([]byte, fitHeaderSize)
+	header[0] = fitHeaderSize
+	header[1] = fitProtocolVersion
+	binary.LittleEndian.PutUint16(header[2:], fitProfileVersion)
+	binary.LittleEndian.PutUint32(header[4:], uint32(e.buf.Len()))
+	copy(header[8:], ".FIT")
+	binary.LittleEndian.PutUint16(header[12:], FITCRC(0, header[:12]))
+
+	crc := FITCRC(FITCRC(0, header), e.buf.Bytes())
+	e.buf.Write([]byte{byte(crc), byte(crc >> 8)})
+
+	if _, err := w.Write(header); err != nil {
+		return errorx.Decorate(err, "failed to write fit header")
+	}
+	if _, err := w.Write(e.buf.Bytes()); err != nil {
+		return errorx.Decorate(err, "failed to write fit records")
+	}
+	return nil
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// FITCRC continues the FIT CRC-16 crc over data.
+func FITCRC(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"io"
+	"strings"
+)
+
+const (
+	FormatGPX      = "gpx"
+	FormatKML      = "kml"
+	FormatGeoJSON  = "geojson"
+	FormatTCX      = "tcx"
+	FormatFIT      = "fit"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatPolyline = "polyline"
+	FormatWKT      = "wkt"
+	FormatEWKT     = "ewkt"
+)
+
+// Options tunes the encoders, each format ignores the options that do not apply to it.
+type Options struct {
+	// Precision is the number of decimals kept by encoded polylines, DefaultPolylinePrecision when zero.
+	Precision int
+	// GPXType selects a GPX track, route or both, see NewGPX.
+	GPXType string
+	// MaxRoutePoints limits the number of GPX route points, all points are kept when zero.
+	MaxRoutePoints int
+	// Force2D writes WKT without elevations, which are otherwise required.
+	Force2D bool
+}
+
+// Format is an output format a track can be encoded to.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Encode      func(w io.Writer, t *Track, opts Options) error
+}
+
+var formats = map[string]Format{
+	FormatGPX:      {Name: FormatGPX, ContentType: GPXContentType, Extension: ".gpx", Encode: EncodeGPX},
+	FormatKML:      {Name: FormatKML, ContentType: KMLContentType, Extension: ".kml", Encode: withoutOptions(EncodeKML)},
+	FormatGeoJSON:  {Name: FormatGeoJSON, ContentType: GeoJSONContentType, Extension: ".geojson", Encode: withoutOptions(EncodeGeoJSON)},
+	FormatTCX:      {Name: FormatTCX, ContentType: TCXContentType, Extension: ".tcx", Encode: withoutOptions(EncodeTCX)},
+	FormatFIT:      {Name: FormatFIT, ContentType: FITContentType, Extension: ".fit", Encode: withoutOptions(EncodeFIT)},
+	FormatCSV:      {Name: FormatCSV, ContentType: CSVContentType, Extension: ".csv", Encode: withoutOptions(EncodeCSV)},
+	FormatTSV:      {Name: FormatTSV, ContentType: TSVContentType, Extension: ".tsv", Encode: withoutOptions(EncodeTSV)},
+	FormatPolyline: {Name: FormatPolyline, ContentType: TextContentType, Extension: ".txt", Encode: EncodePolyline},
+	FormatWKT:      {Name: FormatWKT, ContentType: TextContentType, Extension: ".wkt", Encode: EncodeWKT},
+	FormatEWKT:     {Name: FormatEWKT, ContentType: TextContentType, Extension: ".wkt", Encode: EncodeEWKT},
+}
+
+// LookupFormat returns the format registered under name, an empty name selects GPX.
+func LookupFormat(name string) (Format, bool) {
+	if name == "" {
+		name = FormatGPX
+	}
+	f, ok := formats[strings.ToLower(name)]
+	return f, ok
+}
+
+// Normalize returns only the options the format reads, with their defaults applied, so that options producing the
+// same file compare equal.
+func (f Format) Normalize(opts Options) Options {
+	switch f.Name {
+	case FormatGPX:
+		normalized := Options{GPXType: opts.GPXType}
+		if normalized.GPXType == "" {
+			normalized.GPXType = GPXTypeTrack
+		}
+		if normalized.GPXType != GPXTypeTrack {
+			normalized.MaxRoutePoints = opts.MaxRoutePoints
+		}
+		return normalized
+	case FormatPolyline:
+		if opts.Precision == 0 {
+			return Options{Precision: DefaultPolylinePrecision}
+		}
+		return Options{Precision: opts.Precision}
+	case FormatWKT, FormatEWKT:
+		return Options{Force2D: opts.Force2D}
+	}
+	return Options{}
+}
+
+func withoutOptions(encode func(w io.Writer, t *Track) error) func(w io.Writer, t *Track, opts Options) error {
+	return func(w io.Writer, t *Track, _ Options) error {
+		return encode(w, t)
+	}
+}
@@ -0,0 +1,95 @@
+package export
+
+import (
+	"encoding/json"
+	"github.com/joomcode/errorx"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"io"
+)
+
+const GeoJSONContentType = "application/geo+json"
+
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// GeoJSONGeometry holds a Point position or LineString positions in Coordinates.
+type GeoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// NewGeoJSON converts a track to a FeatureCollection with the route as a LineString feature followed by a Point
+// feature per waypoint. Positions are [lon, lat, ele], the elevation is left out where it is unknown.
+func NewGeoJSON(t *Track) *GeoJSONFeatureCollection {
+	line := make([][]float64, 0, len(t.Points))
+	for _, p := range t.Points {
+		line = append(line, geoJSONPosition(p.LatLng, p.Elevation))
+	}
+
+	distance := 0.0
+	if distances := geo.CumulativeDistances(t.Points); len(distances) > 0 {
+		distance = distances[len(distances)-1]
+	}
+	gain, loss := geo.ElevationGain(t.Points)
+	properties := map[string]any{
+		"name":          t.Name,
+		"distance":      distance,
+		"elevationGain": gain,
+		"elevationLoss": loss,
+	}
+	if t.Description != "" {
+		properties["description"] = t.Description
+	}
+	if t.RouteID != 0 {
+		properties["routeID"] = t.RouteID
+	}
+	if t.Link != "" {
+		properties["link"] = t.Link
+	}
+
+	collection := &GeoJSONFeatureCollection{
+		Type: "FeatureCollection",
+		Features: []GeoJSONFeature{{
+			Type:       "Feature",
+			Geometry:   GeoJSONGeometry{Type: "LineString", Coordinates: line},
+			Properties: properties,
+		}},
+	}
+
+	for _, w := range t.Waypoints {
+		properties := map[string]any{"name": w.Name}
+		if w.Description != "" {
+			properties["description"] = w.Description
+		}
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type:       "Feature",
+			Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: geoJSONPosition(w.LatLng, w.Elevation)},
+			Properties: properties,
+		})
+	}
+
+	return collection
+}
+
+func geoJSONPosition(l geo.LatLng, elevation *float64) []float64 {
+	if elevation == nil {
+		return []float64{l.Lng, l.Lat}
+	}
+	return []float64{l.Lng, l.Lat, *elevation}
+}
+
+// EncodeGeoJSON writes the track as a GeoJSON FeatureCollection.
+func EncodeGeoJSON(w io.Writer, t *Track) error {
+	if err := json.NewEncoder(w).Encode(NewGeoJSON(t)); err != nil {
+		return errorx.Decorate(err, "failed to marshal geojson")
+	}
+	return nil
+}
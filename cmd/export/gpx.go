@@ -0,0 +1,203 @@
+package export
+
+import (
+	"encoding/xml"
+	"github.com/joomcode/errorx"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	GPXContentType    = "application/gpx+xml"
+	gpxNamespace      = "http://www.topografix.com/GPX/1/1"
+	gpxSchemaLocation = gpxNamespace + " http://www.topografix.com/GPX/1/1/gpx.xsd"
+	xsiNamespace      = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// GPX types accepted in Options.GPXType.
+const (
+	GPXTypeTrack = "track"
+	GPXTypeRoute = "route"
+	GPXTypeBoth  = "both"
+)
+
+// MaxRoutePointsLimit is the highest Options.MaxRoutePoints accepted, well above the few hundred route points devices
+// hold.
+const MaxRoutePointsLimit = 1000
+
+// GPX is a GPX 1.1 document.
+type GPX struct {
+	XMLName        xml.Name      `xml:"gpx"`
+	Version        string        `xml:"version,attr"`
+	Creator        string        `xml:"creator,attr"`
+	Namespace      string        `xml:"xmlns,attr"`
+	XSINamespace   string        `xml:"xmlns:xsi,attr"`
+	SchemaLocation string        `xml:"xsi:schemaLocation,attr"`
+	Metadata       *GPXMetadata  `xml:"metadata,omitempty"`
+	Waypoints      []GPXWaypoint `xml:"wpt"`
+	Routes         []GPXRoute    `xml:"rte"`
+	Tracks         []GPXTrack    `xml:"trk"`
+}
+
+type GPXMetadata struct {
+	Name        string     `xml:"name,omitempty"`
+	Description string     `xml:"desc,omitempty"`
+	Link        *GPXLink   `xml:"link,omitempty"`
+	Time        *time.Time `xml:"time,omitempty"`
+	Bounds      *GPXBounds `xml:"bounds,omitempty"`
+}
+
+type GPXLink struct {
+	Href string `xml:"href,attr"`
+	Text string `xml:"text,omitempty"`
+}
+
+type GPXBounds struct {
+	MinLat Decimal `xml:"minlat,attr"`
+	MinLon Decimal `xml:"minlon,attr"`
+	MaxLat Decimal `xml:"maxlat,attr"`
+	MaxLon Decimal `xml:"maxlon,attr"`
+}
+
+type GPXWaypoint struct {
+	Latitude    Decimal    `xml:"lat,attr"`
+	Longitude   Decimal    `xml:"lon,attr"`
+	Elevation   *Decimal   `xml:"ele,omitempty"`
+	Time        *time.Time `xml:"time,omitempty"`
+	Name        string     `xml:"name,omitempty"`
+	Description string     `xml:"desc,omitempty"`
+}
+
+type GPXRoute struct {
+	Name   string        `xml:"name,omitempty"`
+	Points []GPXWaypoint `xml:"rtept"`
+}
+
+type GPXTrack struct {
+	Name     string            `xml:"name,omitempty"`
+	Segments []GPXTrackSegment `xml:"trkseg"`
+}
+
+type GPXTrackSegment struct {
+	Points []GPXWaypoint `xml:"trkpt"`
+}
+
+// Decimal is a float64 written in plain decimal notation, as xsd:decimal does not allow exponents.
+type Decimal float64
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return strconv.AppendFloat(nil, float64(d), 'f', -1, 64), nil
+}
+
+func decimalPtr(f *float64) *Decimal {
+	if f == nil {
+		return nil
+	}
+	d := Decimal(*f)
+	return &d
+}
+
+// ValidGPXType reports whether gpxType is accepted by NewGPX, an empty type selects GPXTypeTrack.
+func ValidGPXType(gpxType string) bool {
+	switch gpxType {
+	case "", GPXTypeTrack, GPXTypeRoute, GPXTypeBoth:
+		return true
+	}
+	return false
+}
+
+// NewGPX converts a track to a GPX document holding a trk, a rte or both as selected by opts.GPXType. Routes are
+// thinned to opts.MaxRoutePoints points.
+func NewGPX(t *Track, opts Options) *GPX {
+	doc := &GPX{
+		Version:        "1.1",
+		Creator:        Creator,
+		Namespace:      gpxNamespace,
+		XSINamespace:   xsiNamespace,
+		SchemaLocation: gpxSchemaLocation,
+		Metadata: &GPXMetadata{
+			Name:        t.Name,
+			Description: t.Description,
+		},
+	}
+	if t.Link != "" {
+		doc.Metadata.Link = &GPXLink{Href: t.Link, Text: t.Name}
+	}
+	if !t.Time.IsZero() {
+		ts := t.Time.UTC()
+		doc.Metadata.Time = &ts
+	}
+	if b, ok := t.Bounds(); ok {
+		doc.Metadata.Bounds = &GPXBounds{
+			MinLat: Decimal(b.Min.Lat),
+			MinLon: Decimal(b.Min.Lng),
+			MaxLat: Decimal(b.Max.Lat),
+			MaxLon: Decimal(b.Max.Lng),
+		}
+	}
+
+	for _, w := range t.Waypoints {
+		doc.Waypoints = append(doc.Waypoints, GPXWaypoint{
+			Latitude:    Decimal(w.Lat),
+			Longitude:   Decimal(w.Lng),
+			Elevation:   decimalPtr(w.Elevation),
+			Name:        w.Name,
+			Description: w.Description,
+		})
+	}
+
+	if opts.GPXType == GPXTypeRoute || opts.GPXType == GPXTypeBoth {
+		locations := make([]geo.LatLng, len(t.Points))
+		for i, p := range t.Points {
+			locations[i] = p.LatLng
+		}
+		maxPoints := opts.MaxRoutePoints
+		if maxPoints <= 0 {
+			maxPoints = len(t.Points)
+		}
+
+		route := GPXRoute{Name: t.Name}
+		for _, i := range geo.Simplify(locations, maxPoints) {
+			route.Points = append(route.Points, gpxPoint(t.Points[i]))
+		}
+		doc.Routes = []GPXRoute{route}
+	}
+
+	if opts.GPXType != GPXTypeRoute {
+		segment := GPXTrackSegment{}
+		for _, p := range t.Points {
+			segment.Points = append(segment.Points, gpxPoint(p))
+		}
+		doc.Tracks = []GPXTrack{{Name: t.Name, Segments: []GPXTrackSegment{segment}}}
+	}
+
+	return doc
+}
+
+func gpxPoint(p geo.Point) GPXWaypoint {
+	point := GPXWaypoint{
+		Latitude:  Decimal(p.Lat),
+		Longitude: Decimal(p.Lng),
+		Elevation: decimalPtr(p.Elevation),
+	}
+	if p.Time != nil {
+		ts := p.Time.UTC()
+		point.Time = &ts
+	}
+	return point
+}
+
+// EncodeGPX writes the track as a GPX 1.1 document, including the XML declaration.
+func EncodeGPX(w io.Writer, t *Track, opts Options) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errorx.Decorate(err, "failed to write xml header")
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(NewGPX(t, opts)); err != nil {
+		return errorx.Decorate(err, "failed to marshal gpx")
+	}
+	return nil
+}
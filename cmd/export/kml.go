@@ -0,0 +1,126 @@
+package export
+
+import (
+	"encoding/xml"
+	"github.com/joomcode/errorx"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	KMLContentType = "application/vnd.google-earth.kml+xml"
+	kmlNamespace   = "http://www.opengis.net/kml/2.2"
+
+	// KMLLineColor is the route line colour in KML's aabbggrr notation and KMLLineWidth its width in pixels.
+	KMLLineColor = "ff1400ff"
+	KMLLineWidth = 4
+	kmlStyleID   = "route"
+)
+
+// KML is a KML 2.2 document.
+type KML struct {
+	XMLName   xml.Name    `xml:"kml"`
+	Namespace string      `xml:"xmlns,attr"`
+	Document  KMLDocument `xml:"Document"`
+}
+
+type KMLDocument struct {
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	Style       KMLStyle       `xml:"Style"`
+	Placemarks  []KMLPlacemark `xml:"Placemark"`
+}
+
+type KMLStyle struct {
+	ID        string       `xml:"id,attr"`
+	LineStyle KMLLineStyle `xml:"LineStyle"`
+}
+
+type KMLLineStyle struct {
+	Color string `xml:"color"`
+	Width int    `xml:"width"`
+}
+
+type KMLPlacemark struct {
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	StyleURL    string         `xml:"styleUrl,omitempty"`
+	LineString  *KMLLineString `xml:"LineString,omitempty"`
+	Point       *KMLPoint      `xml:"Point,omitempty"`
+}
+
+type KMLLineString struct {
+	Tessellate   int    `xml:"tessellate"`
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+type KMLPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// NewKML converts a track to a KML document with the route as a styled LineString and a Placemark per waypoint. The
+// line uses absolute altitudes when every point has an elevation and is clamped to the ground otherwise.
+func NewKML(t *Track) *KML {
+	altitudeMode := "absolute"
+	coordinates := make([]string, 0, len(t.Points))
+	for _, p := range t.Points {
+		if p.Elevation == nil {
+			altitudeMode = "clampToGround"
+		}
+		coordinates = append(coordinates, kmlCoordinate(p.Lat, p.Lng, p.Elevation))
+	}
+
+	doc := &KML{
+		Namespace: kmlNamespace,
+		Document: KMLDocument{
+			Name:        t.Name,
+			Description: t.Description,
+			Style: KMLStyle{
+				ID:        kmlStyleID,
+				LineStyle: KMLLineStyle{Color: KMLLineColor, Width: KMLLineWidth},
+			},
+			Placemarks: []KMLPlacemark{{
+				Name:     t.Name,
+				StyleURL: "#" + kmlStyleID,
+				LineString: &KMLLineString{
+					Tessellate:   1,
+					AltitudeMode: altitudeMode,
+					Coordinates:  strings.Join(coordinates, " "),
+				},
+			}},
+		},
+	}
+
+	for _, w := range t.Waypoints {
+		doc.Document.Placemarks = append(doc.Document.Placemarks, KMLPlacemark{
+			Name:        w.Name,
+			Description: w.Description,
+			Point:       &KMLPoint{Coordinates: kmlCoordinate(w.Lat, w.Lng, w.Elevation)},
+		})
+	}
+
+	return doc
+}
+
+func kmlCoordinate(lat, lng float64, elevation *float64) string {
+	coordinate := strconv.FormatFloat(lng, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+	if elevation != nil {
+		coordinate += "," + strconv.FormatFloat(*elevation, 'f', -1, 64)
+	}
+	return coordinate
+}
+
+// EncodeKML writes the track as a KML 2.2 document, including the XML declaration.
+func EncodeKML(w io.Writer, t *Track) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errorx.Decorate(err, "failed to write xml header")
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(NewKML(t)); err != nil {
+		return errorx.Decorate(err, "failed to marshal kml")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package export
+
+import (
+	"fmt"
+	"github.com/joomcode/errorx"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	TextContentType = "text/plain; charset=utf-8"
+
+	// DefaultPolylinePrecision is the precision of Google encoded polylines, MaxPolylinePrecision the highest
+	// precision EncodePolyline accepts.
+	DefaultPolylinePrecision = 5
+	MaxPolylinePrecision     = 10
+)
+
+// EncodePolyline writes the track points as a Google encoded polyline with opts.Precision decimals. Elevations are not
+// part of the encoding and are dropped.
+func EncodePolyline(w io.Writer, t *Track, opts Options) error {
+	precision := opts.Precision
+	if precision == 0 {
+		precision = DefaultPolylinePrecision
+	}
+	if precision < 0 || precision > MaxPolylinePrecision {
+		return fmt.Errorf("polyline precision %d out of range [1, %d]", precision, MaxPolylinePrecision)
+	}
+
+	factor := math.Pow10(precision)
+	var b strings.Builder
+	var lastLat, lastLng int64
+	for _, p := range t.Points {
+		lat, lng := int64(math.Round(p.Lat*factor)), int64(math.Round(p.Lng*factor))
+		encodePolylineValue(&b, lat-lastLat)
+		encodePolylineValue(&b, lng-lastLng)
+		lastLat, lastLng = lat, lng
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return errorx.Decorate(err, "failed to write polyline")
+	}
+	return nil
+}
+
+func encodePolylineValue(b *strings.Builder, v int64) {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	b.WriteByte(byte(u + 63))
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"encoding/xml"
+	"github.com/joomcode/errorx"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"io"
+	"time"
+)
+
+const (
+	TCXContentType    = "application/vnd.garmin.tcx+xml"
+	tcxNamespace      = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+	tcxSchemaLocation = tcxNamespace + " http://www.garmin.com/xmlschemas/TrainingCenterDatabasev2.xsd"
+
+	tcxCourseNameLength = 15
+	tcxPointNameLength  = 10
+	tcxPointName        = "Waypoint"
+)
+
+// TCX is a Training Center XML document holding a single course.
+type TCX struct {
+	XMLName        xml.Name    `xml:"TrainingCenterDatabase"`
+	Namespace      string      `xml:"xmlns,attr"`
+	XSINamespace   string      `xml:"xmlns:xsi,attr"`
+	SchemaLocation string      `xml:"xsi:schemaLocation,attr"`
+	Courses        []TCXCourse `xml:"Courses>Course"`
+}
+
+type TCXCourse struct {
+	Name        string           `xml:"Name"`
+	Lap         TCXLap           `xml:"Lap"`
+	Track       []TCXTrackpoint  `xml:"Track>Trackpoint"`
+	CoursePoint []TCXCoursePoint `xml:"CoursePoint"`
+}
+
+type TCXLap struct {
+	TotalTimeSeconds Decimal     `xml:"TotalTimeSeconds"`
+	DistanceMeters   Decimal     `xml:"DistanceMeters"`
+	BeginPosition    TCXPosition `xml:"BeginPosition"`
+	EndPosition      TCXPosition `xml:"EndPosition"`
+	Intensity        string      `xml:"Intensity"`
+}
+
+type TCXPosition struct {
+	LatitudeDegrees  Decimal `xml:"LatitudeDegrees"`
+	LongitudeDegrees Decimal `xml:"LongitudeDegrees"`
+}
+
+type TCXTrackpoint struct {
+	Time           time.Time   `xml:"Time"`
+	Position       TCXPosition `xml:"Position"`
+	AltitudeMeters *Decimal    `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters Decimal     `xml:"DistanceMeters"`
+}
+
+type TCXCoursePoint struct {
+	Name           string      `xml:"Name"`
+	Time           time.Time   `xml:"Time"`
+	Position       TCXPosition `xml:"Position"`
+	AltitudeMeters *Decimal    `xml:"AltitudeMeters,omitempty"`
+	PointType      string      `xml:"PointType"`
+	Notes          string      `xml:"Notes,omitempty"`
+}
+
+// NewTCX converts a track to a TCX course. Points without a timestamp are timed at CourseSpeed from the track time,
+// waypoints become Generic course points and sharp changes of heading Left or Right course points.
+func NewTCX(t *Track) *TCX {
+	name := t.Name
+	if name == "" {
+		name = Creator
+	}
+	course := TCXCourse{Name: truncate(name, tcxCourseNameLength)}
+	if len(t.Points) == 0 {
+		return newTCXDocument(course)
+	}
+
+	distances := geo.CumulativeDistances(t.Points)
+	times := courseTimes(t, distances)
+	for i, p := range t.Points {
+		course.Track = append(course.Track, TCXTrackpoint{
+			Time:           times[i],
+			Position:       tcxPosition(p.LatLng),
+			AltitudeMeters: decimalPtr(p.Elevation),
+			DistanceMeters: Decimal(distances[i]),
+		})
+	}
+
+	last := len(t.Points) - 1
+	course.Lap = TCXLap{
+		TotalTimeSeconds: Decimal(times[last].Sub(times[0]).Seconds()),
+		DistanceMeters:   Decimal(distances[last]),
+		BeginPosition:    tcxPosition(t.Points[0].LatLng),
+		EndPosition:      tcxPosition(t.Points[last].LatLng),
+		Intensity:        "Active",
+	}
+
+	for _, p := range coursePoints(t) {
+		name := p.Name
+		if name == "" {
+			name = tcxPointName
+		}
+		course.CoursePoint = append(course.CoursePoint, TCXCoursePoint{
+			Name:           truncate(name, tcxPointNameLength),
+			Time:           times[p.Index],
+			Position:       tcxPosition(p.LatLng),
+			AltitudeMeters: decimalPtr(p.Elevation),
+			PointType:      p.Type,
+			Notes:          p.Notes,
+		})
+	}
+
+	return newTCXDocument(course)
+}
+
+func newTCXDocument(course TCXCourse) *TCX {
+	return &TCX{
+		Namespace:      tcxNamespace,
+		XSINamespace:   xsiNamespace,
+		SchemaLocation: tcxSchemaLocation,
+		Courses:        []TCXCourse{course},
+	}
+}
+
+func tcxPosition(l geo.LatLng) TCXPosition {
+	return TCXPosition{LatitudeDegrees: Decimal(l.Lat), LongitudeDegrees: Decimal(l.Lng)}
+}
+
+// EncodeTCX writes the track as a Training Center XML course, including the XML declaration.
+func EncodeTCX(w io.Writer, t *Track) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errorx.Decorate(err, "failed to write xml header")
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(NewTCX(t)); err != nil {
+		return errorx.Decorate(err, "failed to marshal tcx")
+	}
+	return nil
+}
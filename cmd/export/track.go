@@ -0,0 +1,52 @@
+package export
+
+import (
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"runtime/debug"
+	"time"
+)
+
+const Creator = "gMapToGPX"
+
+// Version is the converter version recorded with stored files. Releases set it with
+// -ldflags "-X github.com/zcvaters/gmap-to-gpx/cmd/export.Version=<version>", otherwise it is the module version.
+var Version = moduleVersion()
+
+func moduleVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// Track is a converted route, independent of the output format.
+type Track struct {
+	Name        string
+	Description string
+	// Link points back to the source route.
+	Link      string
+	RouteID   int
+	Time      time.Time
+	Points    []geo.Point
+	Waypoints []Waypoint
+}
+
+// Waypoint is a named point of interest along a track.
+type Waypoint struct {
+	geo.LatLng
+	Elevation   *float64
+	Name        string
+	Description string
+}
+
+// Bounds returns the bounding box of the track points and waypoints.
+func (t *Track) Bounds() (geo.Bounds, bool) {
+	locations := make([]geo.LatLng, 0, len(t.Points)+len(t.Waypoints))
+	for _, p := range t.Points {
+		locations = append(locations, p.LatLng)
+	}
+	for _, w := range t.Waypoints {
+		locations = append(locations, w.LatLng)
+	}
+	return geo.BoundsOf(locations)
+}
@@ -0,0 +1,66 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"github.com/joomcode/errorx"
+	"io"
+	"strings"
+)
+
+// wktSRID is the spatial reference of EWKT output, WGS84 longitude and latitude.
+const wktSRID = "SRID=4326;"
+
+// ErrMissingElevation is returned for LINESTRING Z output of a track with points of unknown elevation.
+var ErrMissingElevation = errors.New("track has points without elevation")
+
+// EncodeWKT writes the track points as a WKT LINESTRING Z of longitude, latitude and elevation. It fails with
+// ErrMissingElevation when any point has an unknown elevation, unless opts.Force2D asks for a plain LINESTRING.
+func EncodeWKT(w io.Writer, t *Track, opts Options) error {
+	lineString, err := wktLineString(t, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, lineString); err != nil {
+		return errorx.Decorate(err, "failed to write wkt")
+	}
+	return nil
+}
+
+// EncodeEWKT writes the track as EWKT, the WKT of EncodeWKT tagged with SRID 4326.
+func EncodeEWKT(w io.Writer, t *Track, opts Options) error {
+	lineString, err := wktLineString(t, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, wktSRID+lineString); err != nil {
+		return errorx.Decorate(err, "failed to write ewkt")
+	}
+	return nil
+}
+
+func wktLineString(t *Track, opts Options) (string, error) {
+	if len(t.Points) == 0 {
+		if opts.Force2D {
+			return "LINESTRING EMPTY", nil
+		}
+		return "LINESTRING Z EMPTY", nil
+	}
+
+	coordinates := make([]string, 0, len(t.Points))
+	for i, p := range t.Points {
+		coordinate := formatFloat(p.Lng) + " " + formatFloat(p.Lat)
+		if !opts.Force2D {
+			if p.Elevation == nil {
+				return "", fmt.Errorf("%w: point %d", ErrMissingElevation, i)
+			}
+			coordinate += " " + formatFloat(*p.Elevation)
+		}
+		coordinates = append(coordinates, coordinate)
+	}
+
+	if opts.Force2D {
+		return "LINESTRING (" + strings.Join(coordinates, ", ") + ")", nil
+	}
+	return "LINESTRING Z (" + strings.Join(coordinates, ", ") + ")", nil
+}
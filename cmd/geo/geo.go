@@ -0,0 +1,182 @@
+package geo
+
+import (
+	"container/heap"
+	"math"
+	"time"
+)
+
+// LatLng is a WGS84 coordinate in decimal degrees.
+type LatLng struct {
+	Lat float64
+	Lng float64
+}
+
+// Point is a track point. Elevation is in meters and nil when unknown, Time is nil when the point has no timestamp.
+type Point struct {
+	LatLng
+	Elevation *float64
+	Time      *time.Time
+}
+
+// Bounds is the bounding box of a set of coordinates.
+type Bounds struct {
+	Min LatLng
+	Max LatLng
+}
+
+// BoundsOf returns the bounding box of points, ok is false when there are no points.
+func BoundsOf(points []LatLng) (b Bounds, ok bool) {
+	for i, p := range points {
+		if i == 0 {
+			b.Min, b.Max = p, p
+			continue
+		}
+		b.Min.Lat, b.Max.Lat = math.Min(b.Min.Lat, p.Lat), math.Max(b.Max.Lat, p.Lat)
+		b.Min.Lng, b.Max.Lng = math.Min(b.Min.Lng, p.Lng), math.Max(b.Max.Lng, p.Lng)
+	}
+	return b, len(points) > 0
+}
+
+// EarthRadius is the mean earth radius in meters.
+const EarthRadius = 6371008.8
+
+// Distance returns the great circle distance between a and b in meters.
+func Distance(a, b LatLng) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat, dLng := lat2-lat1, (b.Lng-a.Lng)*math.Pi/180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// CumulativeDistances returns the distance in meters from the first point to each point.
+func CumulativeDistances(points []Point) []float64 {
+	distances := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		distances[i] = distances[i-1] + Distance(points[i-1].LatLng, points[i].LatLng)
+	}
+	return distances
+}
+
+// ElevationGain returns the total ascent and descent in meters between points with a known elevation.
+func ElevationGain(points []Point) (gain, loss float64) {
+	var last *float64
+	for _, p := range points {
+		if p.Elevation == nil {
+			continue
+		}
+		if last != nil {
+			if delta := *p.Elevation - *last; delta > 0 {
+				gain += delta
+			} else {
+				loss -= delta
+			}
+		}
+		last = p.Elevation
+	}
+	return gain, loss
+}
+
+// Bearing returns the initial bearing from a to b in degrees clockwise from north, in [0, 360).
+func Bearing(a, b LatLng) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+	y := math.Sin(dLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// Nearest returns the index of the point closest to l, or -1 when there are no points.
+func Nearest(points []Point, l LatLng) int {
+	nearest, best := -1, math.Inf(1)
+	for i, p := range points {
+		if d := Distance(p.LatLng, l); d < best {
+			nearest, best = i, d
+		}
+	}
+	return nearest
+}
+
+// Simplify returns the indexes of at most max points that best keep the shape of points, always including the first
+// and last point. As in Douglas-Peucker, the segment with the point farthest from it is split at that point until max
+// points are kept or no point is off the simplified line.
+func Simplify(points []LatLng, max int) []int {
+	if max >= len(points) || len(points) <= 2 {
+		indexes := make([]int, len(points))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes
+	}
+	if max < 2 {
+		max = 2
+	}
+
+	kept := make([]bool, len(points))
+	kept[0], kept[len(points)-1] = true, true
+	segments := &segmentHeap{}
+	segments.push(points, 0, len(points)-1)
+	for n := 2; n < max && segments.Len() > 0; n++ {
+		s := heap.Pop(segments).(segment)
+		kept[s.farthest] = true
+		segments.push(points, s.start, s.farthest)
+		segments.push(points, s.farthest, s.end)
+	}
+
+	indexes := make([]int, 0, max)
+	for i, k := range kept {
+		if k {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// segment is a part of the line simplified by Simplify and the point between start and end that is farthest from it.
+type segment struct {
+	start, end, farthest int
+	distance             float64
+}
+
+// segmentHeap orders segments by the distance of their farthest point, farthest first.
+type segmentHeap []segment
+
+func (h segmentHeap) Len() int           { return len(h) }
+func (h segmentHeap) Less(i, j int) bool { return h[i].distance > h[j].distance }
+func (h segmentHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x any)        { *h = append(*h, x.(segment)) }
+func (h *segmentHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// push adds the segment from start to end, unless there are no points between them.
+func (h *segmentHeap) push(points []LatLng, start, end int) {
+	if end-start < 2 {
+		return
+	}
+	s := segment{start: start, end: end, farthest: -1, distance: -1}
+	for i := start + 1; i < end; i++ {
+		if d := crossTrackDistance(points[i], points[start], points[end]); d > s.distance {
+			s.farthest, s.distance = i, d
+		}
+	}
+	heap.Push(h, s)
+}
+
+// crossTrackDistance returns the distance in meters from p to the segment a-b, using an equirectangular projection
+// around a which is accurate enough for the short segments of a route.
+func crossTrackDistance(p, a, b LatLng) float64 {
+	scale := math.Cos(a.Lat * math.Pi / 180)
+	px, py := (p.Lng-a.Lng)*scale, p.Lat-a.Lat
+	bx, by := (b.Lng-a.Lng)*scale, b.Lat-a.Lat
+
+	t := 0.0
+	if l := bx*bx + by*by; l > 0 {
+		t = math.Max(0, math.Min(1, (px*bx+py*by)/l))
+	}
+	dx, dy := px-t*bx, py-t*by
+	return math.Sqrt(dx*dx+dy*dy) * math.Pi / 180 * EarthRadius
+}
@@ -0,0 +1,36 @@
+package geo
+
+import (
+	"math"
+	"time"
+)
+
+// maxAdjustedGrade bounds the grades Minetti's cost of running was measured for.
+const maxAdjustedGrade = 0.45
+
+// Timestamp sets the time of every point as if the route was covered at speed, in m/s, from start. When
+// gradeAdjusted is set the speed on each segment is scaled by the energy cost of running its grade relative to flat
+// ground, so climbs are slower and gentle descents faster. Segments with an unknown elevation are taken as flat.
+func Timestamp(points []Point, start time.Time, speed float64, gradeAdjusted bool) {
+	// Each time is start plus the seconds elapsed so far, truncating only the result so no error builds up.
+	elapsed := 0.0
+	for i := range points {
+		if i > 0 {
+			distance := Distance(points[i-1].LatLng, points[i].LatLng)
+			seconds := distance / speed
+			if gradeAdjusted && distance > 0 && points[i-1].Elevation != nil && points[i].Elevation != nil {
+				seconds *= gradeCost((*points[i].Elevation - *points[i-1].Elevation) / distance)
+			}
+			elapsed += seconds
+		}
+		ts := start.Add(time.Duration(elapsed * float64(time.Second))).Truncate(time.Millisecond)
+		points[i].Time = &ts
+	}
+}
+
+// gradeCost returns the energy cost of running at grade relative to flat ground, from Minetti et al. (2002).
+func gradeCost(grade float64) float64 {
+	i := math.Max(-maxAdjustedGrade, math.Min(maxAdjustedGrade, grade))
+	cost := 155.4*math.Pow(i, 5) - 30.4*math.Pow(i, 4) - 43.3*math.Pow(i, 3) + 46.3*i*i + 19.5*i + 3.6
+	return cost / 3.6
+}
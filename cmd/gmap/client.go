@@ -0,0 +1,81 @@
+package gmap
+
+import (
+	"context"
+	"fmt"
+	"github.com/joomcode/errorx"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://www.gmap-pedometer.com"
+	DefaultTimeout = 30 * time.Second
+	// MinRouteID is the lowest route ID served by the ajaxRoute endpoint.
+	MinRouteID = 5000000
+	routePath  = "/gp/ajaxRoute/get"
+)
+
+// Client fetches saved routes from gmap-pedometer.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Client for the given base URL. An empty base URL falls back to DefaultBaseURL
+// and a zero timeout falls back to DefaultTimeout.
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// GetRoute fetches and parses the route saved under routeID.
+func (c *Client) GetRoute(ctx context.Context, routeID int) (*Route, error) {
+	if routeID < MinRouteID {
+		return nil, fmt.Errorf("invalid route ID: %d, must be greater than %d", routeID, MinRouteID)
+	}
+
+	reqData := url.Values{"rId": {fmt.Sprint(routeID)}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+routePath, strings.NewReader(reqData))
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed to create gMap api request")
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed gMap api request")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed to read the gMap response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected gMap api status %d: %q", resp.StatusCode, respBody)
+	}
+
+	return ParseRoute(respBody)
+}
+
+// RouteURL returns the link to view routeID on gmap-pedometer.
+func (c *Client) RouteURL(routeID int) string {
+	return fmt.Sprintf("%s/?r=%d", c.BaseURL, routeID)
+}
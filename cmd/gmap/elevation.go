@@ -0,0 +1,39 @@
+package gmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DecodeElevation decodes the elev field of a route into one elevation in meters per polyline point. The field is
+// expected to hold "a" separated values in polyline order, like the polyline itself, where points gmap-pedometer has
+// no elevation for are empty or "null" and are returned as nil.
+//
+// This layout mirrors the polyline field. Until TestRecordedRoutes has a recorded response to confirm it and the unit,
+// payloads in any other layout are reported as errors rather than guessed at, so ElevationSourceAuto logs them and
+// falls back to the elevation provider.
+func DecodeElevation(elev string, points int) ([]*float64, error) {
+	if elev == "" {
+		return make([]*float64, points), nil
+	}
+
+	tokens := strings.Split(elev, "a")
+	if len(tokens) != points {
+		return nil, fmt.Errorf("route has %d elevation values for %d points", len(tokens), points)
+	}
+
+	elevations := make([]*float64, points)
+	for i, token := range tokens {
+		if token == "" || token == "null" {
+			continue
+		}
+		elevation, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid elevation %q at index %d", token, i)
+		}
+		elevations[i] = &elevation
+	}
+
+	return elevations, nil
+}
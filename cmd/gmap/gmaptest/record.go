@@ -0,0 +1,47 @@
+package gmaptest
+
+import (
+	"context"
+	"fmt"
+	"github.com/joomcode/errorx"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Record fetches the ajaxRoute responses of routeIDs from the gmap-pedometer server at baseURL and writes them into
+// dir as fixtures NewServer can replay. Bodies are written as received, without parsing them.
+func Record(ctx context.Context, baseURL, dir string, routeIDs ...int) error {
+	for _, routeID := range routeIDs {
+		body := url.Values{"rId": {strconv.Itoa(routeID)}}.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/gp/ajaxRoute/get", strings.NewReader(body))
+		if err != nil {
+			return errorx.Decorate(err, "failed to create request for route %d", routeID)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return errorx.Decorate(err, "failed to fetch route %d", routeID)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return errorx.Decorate(err, "failed to read route %d", routeID)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d fetching route %d", resp.StatusCode, routeID)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return errorx.Decorate(err, "failed to create fixture directory")
+		}
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(routeID)+".txt"), respBody, 0o644); err != nil {
+			return errorx.Decorate(err, "failed to write route %d", routeID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Package gmaptest provides a stand-in for the gmap-pedometer ajaxRoute endpoint that replays canned responses.
+//
+// Fixtures are response bodies named after their route ID, e.g. testdata/gmap/synthetic/7696696.txt. The fixtures in
+// testdata/gmap/synthetic are hand-written in the form encoded layout of ajaxRoute, they are not captures of real
+// routes. Real responses are recorded with Record into testdata/gmap/recorded, see TestRecordedRoutes in cmd/test.
+package gmaptest
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// NewServer starts a fake gmap-pedometer server serving the fixtures in dir. Routes without a fixture get an empty
+// body, which is what gmap-pedometer returns for unknown route IDs. Callers should Close the server when done.
+func NewServer(dir string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gp/ajaxRoute/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		routeID, err := strconv.Atoi(r.PostForm.Get("rId"))
+		if err != nil {
+			http.Error(w, "invalid rId", http.StatusBadRequest)
+			return
+		}
+
+		body, err := os.ReadFile(filepath.Join(dir, strconv.Itoa(routeID)+".txt"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		_, _ = w.Write(body)
+	})
+
+	return httptest.NewServer(mux)
+}
@@ -0,0 +1,103 @@
+package gmap
+
+import (
+	"fmt"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PointOfInterest is a marker placed on a route, e.g. an aid station.
+type PointOfInterest struct {
+	geo.LatLng
+	Name        string
+	Description string
+}
+
+// PointOfInterestError describes a marker that could not be decoded.
+type PointOfInterestError struct {
+	// Index is the position of Marker in the ";" separated markers.
+	Index  int
+	Marker string
+	Reason string
+}
+
+func (e *PointOfInterestError) Error() string {
+	return fmt.Sprintf("invalid point of interest %q at index %d: %s", e.Marker, e.Index, e.Reason)
+}
+
+// SkippedPointsOfInterestError lists the markers DecodePointsOfInterest skipped.
+type SkippedPointsOfInterestError struct {
+	Skipped []PointOfInterestError
+}
+
+func (e *SkippedPointsOfInterestError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "skipped %d point(s) of interest", len(e.Skipped))
+	for _, skipped := range e.Skipped {
+		fmt.Fprintf(&b, "; %s", skipped.Error())
+	}
+	return b.String()
+}
+
+// DecodePointsOfInterest decodes the pta field of a route. Markers are expected to be separated by ";" and hold the
+// comma separated fields latitude, longitude, name and description, where name and description are query escaped,
+// e.g. 47.56712,-52.70405,Aid+station+1,Water+and+gels;47.56947,-52.68203,Cabot+Tower,
+//
+// Markers that do not decode are skipped and reported in a *SkippedPointsOfInterestError, returned together with the
+// markers that did decode, so a marker layout TestRecordedRoutes has yet to see costs only the odd waypoint.
+func DecodePointsOfInterest(pta string) ([]PointOfInterest, error) {
+	if pta == "" {
+		return nil, nil
+	}
+
+	var (
+		pois    []PointOfInterest
+		skipped []PointOfInterestError
+	)
+	for i, marker := range strings.Split(pta, ";") {
+		if marker == "" {
+			continue
+		}
+		poi, reason := decodePointOfInterest(marker)
+		if reason != "" {
+			skipped = append(skipped, PointOfInterestError{Index: i, Marker: marker, Reason: reason})
+			continue
+		}
+		pois = append(pois, poi)
+	}
+
+	if len(skipped) > 0 {
+		return pois, &SkippedPointsOfInterestError{Skipped: skipped}
+	}
+	return pois, nil
+}
+
+// decodePointOfInterest decodes a single marker, or returns why it could not.
+func decodePointOfInterest(marker string) (PointOfInterest, string) {
+	fields := strings.SplitN(marker, ",", 4)
+	if len(fields) < 2 {
+		return PointOfInterest{}, "missing coordinates"
+	}
+	lat, latErr := strconv.ParseFloat(fields[0], 64)
+	lng, lngErr := strconv.ParseFloat(fields[1], 64)
+	if latErr != nil || lngErr != nil || math.IsNaN(lat) || math.IsNaN(lng) || math.Abs(lat) > 90 || math.Abs(lng) > 180 {
+		return PointOfInterest{}, "invalid coordinates"
+	}
+
+	poi := PointOfInterest{LatLng: geo.LatLng{Lat: lat, Lng: lng}}
+	var err error
+	if len(fields) > 2 {
+		if poi.Name, err = url.QueryUnescape(fields[2]); err != nil {
+			return PointOfInterest{}, fmt.Sprintf("invalid name: %s", err)
+		}
+	}
+	if len(fields) > 3 {
+		if poi.Description, err = url.QueryUnescape(fields[3]); err != nil {
+			return PointOfInterest{}, fmt.Sprintf("invalid description: %s", err)
+		}
+	}
+	return poi, ""
+}
@@ -0,0 +1,65 @@
+package gmap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrEmptyPolyline is returned by DecodePolyline for routes without any points.
+var ErrEmptyPolyline = errors.New("polyline has no points")
+
+// PolylineError describes the polyline token that could not be decoded.
+type PolylineError struct {
+	// Index is the position of Token in the "a" separated polyline.
+	Index  int
+	Token  string
+	Reason string
+}
+
+func (e *PolylineError) Error() string {
+	return fmt.Sprintf("invalid polyline token %q at index %d: %s", e.Token, e.Index, e.Reason)
+}
+
+// DecodePolyline decodes the polyline field of a route, "a" separated latitude and longitude pairs in decimal degrees,
+// e.g. 47.56183a-52.71244a47.56401a-52.70882.
+func DecodePolyline(polyline string) ([]geo.LatLng, error) {
+	if polyline == "" {
+		return nil, ErrEmptyPolyline
+	}
+
+	tokens := strings.Split(polyline, "a")
+	if len(tokens)%2 != 0 {
+		return nil, &PolylineError{Index: len(tokens) - 1, Token: tokens[len(tokens)-1], Reason: "latitude without a longitude"}
+	}
+
+	points := make([]geo.LatLng, 0, len(tokens)/2)
+	for i := 0; i < len(tokens); i += 2 {
+		lat, err := parseCoordinate(tokens, i, 90)
+		if err != nil {
+			return nil, err
+		}
+		lng, err := parseCoordinate(tokens, i+1, 180)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, geo.LatLng{Lat: lat, Lng: lng})
+	}
+
+	return points, nil
+}
+
+func parseCoordinate(tokens []string, index int, limit float64) (float64, error) {
+	token := tokens[index]
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, &PolylineError{Index: index, Token: token, Reason: "not a number"}
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) || math.Abs(value) > limit {
+		return 0, &PolylineError{Index: index, Token: token, Reason: fmt.Sprintf("out of range [-%v, %v]", limit, limit)}
+	}
+	return value, nil
+}
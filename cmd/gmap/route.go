@@ -0,0 +1,58 @@
+package gmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/joomcode/errorx"
+	"net/url"
+)
+
+// Route is a saved gmap-pedometer route as returned by the ajaxRoute endpoint.
+type Route struct {
+	CenterX         string `json:"centerX"`
+	CenterY         string `json:"centerY"`
+	ZoomLevel       string `json:"zl"`
+	ZoomView        string `json:"zv"`
+	Filter          string `json:"fl"`
+	Polyline        string `json:"polyline"`
+	Elevation       string `json:"elev"`
+	ResourceID      string `json:"rId"`
+	RandomValue     string `json:"rdm"`
+	PointOfInterest string `json:"pta"`
+	Distance        string `json:"distance"`
+	ShowName        string `json:"show_name_description"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	// PayloadHash is the hex encoded SHA-256 of the fields a conversion is made from. It changes when the route is
+	// edited, but not with fields such as RandomValue that differ between responses for the same route.
+	PayloadHash string `json:"-"`
+}
+
+// ParseRoute parses the form encoded body of an ajaxRoute response.
+func ParseRoute(body []byte) (*Route, error) {
+	query, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errorx.Decorate(err, "failed to parse query parameters")
+	}
+	route := &Route{
+		CenterX:         query.Get("centerX"),
+		CenterY:         query.Get("centerY"),
+		ZoomLevel:       query.Get("zl"),
+		ZoomView:        query.Get("zv"),
+		Filter:          query.Get("fl"),
+		Polyline:        query.Get("polyline"),
+		Elevation:       query.Get("elev"),
+		ResourceID:      query.Get("rId"),
+		RandomValue:     query.Get("rdm"),
+		PointOfInterest: query.Get("pta"),
+		Distance:        query.Get("distance"),
+		ShowName:        query.Get("show_name_description"),
+		Name:            query.Get("name"),
+		Description:     query.Get("description"),
+	}
+	payload, _ := json.Marshal([]string{route.Polyline, route.Elevation, route.PointOfInterest, route.Name, route.Description})
+	hash := sha256.Sum256(payload)
+	route.PayloadHash = hex.EncodeToString(hash[:])
+	return route, nil
+}
@@ -3,22 +3,92 @@ package test
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/zcvaters/gmap-to-gpx/cmd/api/handlers"
 	"github.com/zcvaters/gmap-to-gpx/cmd/configure/environment"
+	"github.com/zcvaters/gmap-to-gpx/cmd/configure/logging"
 	"github.com/zcvaters/gmap-to-gpx/cmd/configure/router"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap/gmaptest"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-var server = router.CreateNewServer()
+var (
+	server       = router.CreateNewServer()
+	testHandlers *handlers.Handlers
+)
 
 func TestMain(m *testing.M) {
+	// os.Exit skips deferred calls, so the suite runs in testMain for its cleanups to run first.
+	os.Exit(testMain(m))
+}
+
+func testMain(m *testing.M) int {
+	if provider, ok := os.LookupEnv("ELEVATION_PROVIDER"); !ok || provider == "" {
+		if err := os.Setenv("ELEVATION_PROVIDER", data.ElevationFake); err != nil {
+			log.Fatalf("failed to set ELEVATION_PROVIDER: %v", err)
+		}
+	}
+	// Store conversions on local disk unless STORAGE_BACKEND selects another backend.
+	if backend, ok := os.LookupEnv("STORAGE_BACKEND"); !ok || backend == "" {
+		dir, err := os.MkdirTemp("", "gmap-to-gpx-storage")
+		if err != nil {
+			log.Fatalf("failed to create storage directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		for key, value := range map[string]string{"STORAGE_BACKEND": data.StorageLocal, "STORAGE_DIR": dir} {
+			if err := os.Setenv(key, value); err != nil {
+				log.Fatalf("failed to set %s: %v", key, err)
+			}
+		}
+	}
+	if token, ok := os.LookupEnv("ADMIN_TOKEN"); !ok || token == "" {
+		if err := os.Setenv("ADMIN_TOKEN", "test-admin-token"); err != nil {
+			log.Fatalf("failed to set ADMIN_TOKEN: %v", err)
+		}
+	}
+	if address, ok := os.LookupEnv("ADDRESS"); !ok || address == "" {
+		if err := os.Setenv("ADDRESS", "localhost:8080"); err != nil {
+			log.Fatalf("failed to set ADDRESS: %v", err)
+		}
+	}
+	// Replay synthetic gmap-pedometer responses unless GMAP_URL points the suite at a real upstream.
+	if gMapURL, ok := os.LookupEnv("GMAP_URL"); !ok || gMapURL == "" {
+		fake := gmaptest.NewServer("testdata/gmap/synthetic")
+		if err := os.Setenv("GMAP_URL", fake.URL); err != nil {
+			log.Fatalf("failed to set GMAP_URL: %v", err)
+		}
+		defer fake.Close()
+	}
+	return runTests(m)
+}
+
+func runTests(m *testing.M) int {
 	h := &handlers.Handlers{}
 	h.Environment = environment.CreateNewEnv()
+	h.Log = logging.CreateNewLogger(h.Environment.Production)
 	server.MountHandlers(h)
-	os.Exit(m.Run())
+	testHandlers = h
+	return m.Run()
+}
+
+// newServer mounts handlers sharing the storage and upstream of the test server, with the environment changed by
+// configure.
+func newServer(configure func(env *environment.Environment)) *router.Server {
+	env := *testHandlers.Environment
+	configure(&env)
+	s := router.CreateNewServer()
+	s.MountHandlers(&handlers.Handlers{Environment: &env, Log: testHandlers.Log})
+	return s
 }
 
 func TestConvertGMAPToGPX(t *testing.T) {
@@ -28,12 +98,34 @@ func TestConvertGMAPToGPX(t *testing.T) {
 		status int
 	}
 
+	startTime := time.Date(2023, 6, 4, 8, 0, 0, 0, time.UTC)
 	tt := []test{
 		{desc: "Nil input", input: nil, status: http.StatusBadRequest},
 		{desc: "Invalid json to unmarshal", input: `{"test": 123}`, status: http.StatusBadRequest},
 		{desc: "Invalid Route ID", input: &handlers.GMapToGPXRequest{RouteID: 4999999}, status: http.StatusBadRequest},
+		{desc: "Unknown Route ID", input: &handlers.GMapToGPXRequest{RouteID: 5999999}, status: http.StatusBadRequest},
 		{desc: "Valid Route ID", input: &handlers.GMapToGPXRequest{RouteID: 5000001}, status: http.StatusOK},
 		{desc: "Random Route ID", input: &handlers.GMapToGPXRequest{RouteID: 7696696}, status: http.StatusOK},
+		{desc: "Invalid elevation source", input: &handlers.GMapToGPXRequest{RouteID: 7696696, ElevationSource: "usgs"}, status: http.StatusBadRequest},
+		{desc: "gMap elevation source", input: &handlers.GMapToGPXRequest{RouteID: 7696696, ElevationSource: handlers.ElevationSourceGMap}, status: http.StatusOK},
+		{desc: "Invalid format", input: &handlers.GMapToGPXRequest{RouteID: 7696696, Format: "shp"}, status: http.StatusBadRequest},
+		{desc: "KML format", input: &handlers.GMapToGPXRequest{RouteID: 7696696, Format: export.FormatKML}, status: http.StatusOK},
+		{desc: "GeoJSON format", input: &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatGeoJSON}, status: http.StatusOK},
+		{desc: "TCX format", input: &handlers.GMapToGPXRequest{RouteID: 7696696, Format: export.FormatTCX}, status: http.StatusOK},
+		{desc: "FIT format", input: &handlers.GMapToGPXRequest{RouteID: 7696696, Format: export.FormatFIT}, status: http.StatusOK},
+		{desc: "CSV format", input: &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatCSV}, status: http.StatusOK},
+		{desc: "Polyline format", input: &handlers.GMapToGPXRequest{RouteID: 7696696, Format: export.FormatPolyline, Precision: 6}, status: http.StatusOK},
+		{desc: "Invalid polyline precision", input: &handlers.GMapToGPXRequest{RouteID: 7696696, Format: export.FormatPolyline, Precision: 11}, status: http.StatusBadRequest},
+		{desc: "EWKT format", input: &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatEWKT}, status: http.StatusOK},
+		{desc: "WKT without elevations", input: &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatWKT, ElevationSource: handlers.ElevationSourceGMap}, status: http.StatusUnprocessableEntity},
+		{desc: "2D WKT without elevations", input: &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatWKT, ElevationSource: handlers.ElevationSourceGMap, Force2D: true}, status: http.StatusOK},
+		{desc: "GPX route", input: &handlers.GMapToGPXRequest{RouteID: 7696696, GPXType: export.GPXTypeRoute, MaxRoutePoints: 4}, status: http.StatusOK},
+		{desc: "Too many GPX route points", input: &handlers.GMapToGPXRequest{RouteID: 7696696, GPXType: export.GPXTypeRoute, MaxRoutePoints: export.MaxRoutePointsLimit + 1}, status: http.StatusBadRequest},
+		{desc: "Invalid GPX type", input: &handlers.GMapToGPXRequest{RouteID: 7696696, GPXType: "rtept"}, status: http.StatusBadRequest},
+		{desc: "Timestamps from pace", input: &handlers.GMapToGPXRequest{RouteID: 7696696, StartTime: &startTime, Pace: 5.5, GradeAdjusted: true}, status: http.StatusOK},
+		{desc: "Pace without start time", input: &handlers.GMapToGPXRequest{RouteID: 7696696, Pace: 5.5}, status: http.StatusBadRequest},
+		{desc: "Start time without speed", input: &handlers.GMapToGPXRequest{RouteID: 7696696, StartTime: &startTime}, status: http.StatusBadRequest},
+		{desc: "Provider elevation source", input: &handlers.GMapToGPXRequest{RouteID: 7696696, ElevationSource: handlers.ElevationSourceProvider}, status: http.StatusOK},
 	}
 	for _, tc := range tt {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -53,15 +145,264 @@ func TestConvertGMAPToGPX(t *testing.T) {
 	}
 }
 
+func TestConvertGMAPToGPXInline(t *testing.T) {
+	type test struct {
+		desc        string
+		query       string
+		accept      string
+		input       *handlers.GMapToGPXRequest
+		contentType string
+		disposition string
+	}
+
+	tt := []test{
+		{desc: "Inline query parameter", query: "?inline=true", input: &handlers.GMapToGPXRequest{RouteID: 7696696, FileName: "loop"},
+			contentType: export.GPXContentType, disposition: `attachment; filename=loop.gpx`},
+		{desc: "Accept header", accept: export.KMLContentType, input: &handlers.GMapToGPXRequest{RouteID: 7696696, Format: export.FormatKML},
+			contentType: export.KMLContentType, disposition: `attachment; filename="Signal Hill Loop.kml"`},
+		{desc: "Sanitized file name", query: "?inline=true", input: &handlers.GMapToGPXRequest{RouteID: 7696696, FileName: `../..\\.run "loop".GPX`},
+			contentType: export.GPXContentType, disposition: `attachment; filename="run _loop.gpx"`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			reqBody, err := json.Marshal(tc.input)
+			if err != nil {
+				t.Fatalf("failed to marshal request data: %v", err)
+			}
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/gMapToGPX"+tc.query, bytes.NewReader(reqBody))
+			if err != nil {
+				t.Fatalf("failed to create a new request: %v", err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			rr := executeRequest(req, server)
+			checkResponseCode(t, http.StatusOK, rr.Code)
+			if contentType := rr.Header().Get("Content-Type"); contentType != tc.contentType {
+				t.Errorf("Expected Content-Type %q. Got %q", tc.contentType, contentType)
+			}
+			if disposition := rr.Header().Get("Content-Disposition"); disposition != tc.disposition {
+				t.Errorf("Expected Content-Disposition %q. Got %q", tc.disposition, disposition)
+			}
+			if !bytes.HasPrefix(rr.Body.Bytes(), []byte("<?xml")) {
+				t.Errorf("Expected an xml document. Got %q", rr.Body)
+			}
+		})
+	}
+}
+
+// convert requests a conversion of input and returns the download URL of the converted file.
+func convert(t *testing.T, s *router.Server, input *handlers.GMapToGPXRequest) *url.URL {
+	t.Helper()
+	reqBody, err := json.Marshal(input)
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/gMapToGPX", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to create a new request: %v", err)
+	}
+	rr := executeRequest(req, s)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var res struct {
+		Data handlers.GMapToGPXResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	download, err := url.Parse(res.Data.URL)
+	if err != nil {
+		t.Fatalf("failed to parse download url %q: %v", res.Data.URL, err)
+	}
+	return download
+}
+
+func TestDownloadFile(t *testing.T) {
+	download := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 7696696})
+
+	req, err := http.NewRequest(http.MethodGet, download.RequestURI(), nil)
+	if err != nil {
+		t.Fatalf("failed to create a new request: %v", err)
+	}
+	rr := executeRequest(req, server)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if contentType := rr.Header().Get("Content-Type"); contentType != export.GPXContentType {
+		t.Errorf("Expected Content-Type %q. Got %q", export.GPXContentType, contentType)
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename="Signal Hill Loop.gpx"` {
+		t.Errorf("Expected the route name as file name. Got %q", disposition)
+	}
+	if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != data.DefaultCacheControl {
+		t.Errorf("Expected Cache-Control %q. Got %q", data.DefaultCacheControl, cacheControl)
+	}
+	if !bytes.HasPrefix(rr.Body.Bytes(), []byte("<?xml")) {
+		t.Errorf("Expected an xml document. Got %q", rr.Body)
+	}
+
+	tampered := download.Query()
+	tampered.Set("expires", "9999999999")
+	req, err = http.NewRequest(http.MethodGet, download.Path+"?"+tampered.Encode(), nil)
+	if err != nil {
+		t.Fatalf("failed to create a new request: %v", err)
+	}
+	rr = executeRequest(req, server)
+	checkResponseCode(t, http.StatusForbidden, rr.Code)
+}
+
+func TestConvertGMAPToGPXDeduplication(t *testing.T) {
+	first := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, FileName: "first"})
+	second := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, FileName: "second"})
+	if first.Path != second.Path {
+		t.Errorf("Expected identical conversions to share %q. Got %q", first.Path, second.Path)
+	}
+	if disposition := second.Query().Get("disposition"); disposition != "attachment; filename=second.gpx" {
+		t.Errorf("Expected the second file name in the url. Got %q", disposition)
+	}
+
+	kml := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatKML})
+	if kml.Path == first.Path {
+		t.Errorf("Expected another format to be stored separately. Got %q for both", kml.Path)
+	}
+	route := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, GPXType: export.GPXTypeRoute})
+	if route.Path == first.Path {
+		t.Errorf("Expected other options to be stored separately. Got %q for both", route.Path)
+	}
+
+	ignored := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, GPXType: export.GPXTypeTrack, Precision: 6, Force2D: true})
+	if ignored.Path != first.Path {
+		t.Errorf("Expected options GPX ignores to share %q. Got %q", first.Path, ignored.Path)
+	}
+	polyline := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatPolyline})
+	precise := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, Format: export.FormatPolyline, Precision: export.DefaultPolylinePrecision})
+	if polyline.Path != precise.Path {
+		t.Errorf("Expected the default precision to share %q. Got %q", polyline.Path, precise.Path)
+	}
+
+	start := time.Date(2023, 6, 1, 9, 0, 0, 0, time.UTC)
+	local := start.In(time.FixedZone("NDT", -(2*60+30)*60))
+	utc := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, StartTime: &start, Pace: 5})
+	zoned := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 5000001, StartTime: &local, Pace: 5})
+	if utc.Path != zoned.Path {
+		t.Errorf("Expected the same start time in another zone to share %q. Got %q", utc.Path, zoned.Path)
+	}
+}
+
+func TestPurgeFile(t *testing.T) {
+	download := convert(t, server, &handlers.GMapToGPXRequest{RouteID: 7696696, Format: export.FormatTCX})
+	purgePath := strings.Replace(download.Path, "/api/v1/files/", "/api/v1/admin/files/", 1)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+
+	type test struct {
+		desc   string
+		token  string
+		status int
+	}
+	tt := []test{
+		{desc: "Without token", status: http.StatusUnauthorized},
+		{desc: "Wrong token", token: "guess", status: http.StatusUnauthorized},
+		{desc: "Admin token", token: adminToken, status: http.StatusNoContent},
+		{desc: "Purged before", token: adminToken, status: http.StatusNotFound},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodDelete, purgePath, nil)
+			if err != nil {
+				t.Fatalf("failed to create a new request: %v", err)
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := executeRequest(req, server)
+			checkResponseCode(t, tc.status, rr.Code)
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, "/api/v1/admin/files/conversions/../secret", nil)
+	if err != nil {
+		t.Fatalf("failed to create a new request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr := executeRequest(req, server)
+	checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+	req, err = http.NewRequest(http.MethodGet, download.RequestURI(), nil)
+	if err != nil {
+		t.Fatalf("failed to create a new request: %v", err)
+	}
+	rr = executeRequest(req, server)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
+
+func TestConvertGMAPToGPXElevationDeduplication(t *testing.T) {
+	input := &handlers.GMapToGPXRequest{RouteID: 7696696, ElevationSource: handlers.ElevationSourceProvider}
+	stored := convert(t, server, input)
+
+	none := newServer(func(env *environment.Environment) {
+		env.ElevationProvider = data.ElevationNone
+		env.Elevation = data.NoElevation{}
+	})
+	if other := convert(t, none, input); other.Path == stored.Path {
+		t.Errorf("Expected another elevation provider to be stored separately. Got %q for both", other.Path)
+	}
+
+	// The chunk starting at the fourth point fails, leaving the conversion without some elevations.
+	failing := newServer(func(env *environment.Environment) {
+		env.ElevationProvider = "failing"
+		env.Elevation = &data.ChunkedElevation{Provider: latitudeElevation{failAt: 47.57034}, ChunkSize: 3, Concurrency: 1}
+	})
+	first := convert(t, failing, input)
+	second := convert(t, failing, input)
+	if first.Path == stored.Path || first.Path == second.Path {
+		t.Errorf("Expected partial conversions to never be reused. Got %q, %q and %q", stored.Path, first.Path, second.Path)
+	}
+	if !strings.Contains(first.Path, "/partial-") {
+		t.Errorf("Expected a partial object key. Got %q", first.Path)
+	}
+
+	reqBody, _ := json.Marshal(input)
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/gMapToGPX", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to create a new request: %v", err)
+	}
+	rr := executeRequest(req, failing)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var res struct {
+		Data handlers.GMapToGPXResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if res.Data.MissingElevations != 3 {
+		t.Errorf("Expected the 3 points of the failed chunk to be reported missing. Got %d", res.Data.MissingElevations)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, "/api/v1/gMapToGPX?inline=true", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to create a new request: %v", err)
+	}
+	rr = executeRequest(req, failing)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if missing := rr.Header().Get("X-Missing-Elevations"); missing != "3" {
+		t.Errorf("Expected X-Missing-Elevations: 3 for an inline file. Got %q", missing)
+	}
+}
+
 func checkResponseCode(t *testing.T, expected, actual int) {
 	if expected != actual {
 		t.Errorf("Expected response code %d. Got %d\n", expected, actual)
 	}
 }
 
+var requests uint32
+
 func executeRequest(req *http.Request, s *router.Server) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
 	req.Header.Set("Content-Type", "application/json")
+	// Every request comes from its own address to stay below the rate limit.
+	n := atomic.AddUint32(&requests, 1)
+	req.Header.Set("X-Real-IP", fmt.Sprintf("10.0.%d.%d", n/256, n%256))
 	s.Router.ServeHTTP(rr, req)
 
 	return rr
@@ -0,0 +1,38 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"testing"
+)
+
+func TestEncodeTSV(t *testing.T) {
+	track := &export.Track{Points: []geo.Point{
+		{LatLng: geo.LatLng{Lat: 0, Lng: 0}, Elevation: float64Ptr(10)},
+		{LatLng: geo.LatLng{Lat: 0.001, Lng: 0}, Elevation: float64Ptr(15)},
+		{LatLng: geo.LatLng{Lat: 0.002, Lng: 0}},
+	}}
+
+	var buf bytes.Buffer
+	if err := export.EncodeTSV(&buf, track); err != nil {
+		t.Fatalf("failed to encode tsv: %v", err)
+	}
+	r := csv.NewReader(&buf)
+	r.Comma = '\t'
+	rows, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse tsv: %v", err)
+	}
+	if len(rows) != 4 || rows[0][5] != "grade" {
+		t.Fatalf("Expected a header and 3 rows. Got %v", rows)
+	}
+	// 0.001 degrees of latitude is about 111.2 m, so climbing 5 m is a 4.5% grade.
+	if rows[2][5] != "4.50" {
+		t.Errorf("Expected a grade of 4.50. Got %q", rows[2][5])
+	}
+	if rows[3][2] != "" || rows[3][5] != "" {
+		t.Errorf("Expected no elevation or grade for the last point. Got %v", rows[3])
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"io"
+	"testing"
+)
+
+// latitudeElevation returns each location's latitude as its elevation and fails chunks starting at failAt.
+type latitudeElevation struct {
+	failAt float64
+}
+
+func (l latitudeElevation) Lookup(_ context.Context, locations []geo.LatLng) ([]*float64, error) {
+	if len(locations) > 3 {
+		return nil, fmt.Errorf("chunk of %d locations exceeds the chunk size", len(locations))
+	}
+	if locations[0].Lat == l.failAt {
+		return nil, errors.New("upstream unavailable")
+	}
+	elevations := make([]*float64, len(locations))
+	for i, loc := range locations {
+		lat := loc.Lat
+		elevations[i] = &lat
+	}
+	return elevations, nil
+}
+
+func TestChunkedElevation(t *testing.T) {
+	locations := make([]geo.LatLng, 10)
+	for i := range locations {
+		locations[i] = geo.LatLng{Lat: float64(i + 1)}
+	}
+
+	chunked := &data.ChunkedElevation{Provider: latitudeElevation{failAt: 4}, ChunkSize: 3, Concurrency: 2}
+	elevations, err := chunked.Lookup(context.Background(), locations)
+
+	var partialErr *data.PartialElevationError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("Expected a partial elevation error. Got %v", err)
+	}
+	if len(partialErr.Failures) != 1 || partialErr.Failures[0].Start != 3 || partialErr.Failures[0].End != 6 {
+		t.Errorf("Expected locations 3-5 to fail. Got %+v", partialErr.Failures)
+	}
+	expected := []float64{1, 2, 3, 0, 0, 0, 7, 8, 9, 10}
+	for i := range expected {
+		if i >= 3 && i < 6 {
+			if elevations[i] != nil {
+				t.Errorf("Expected no elevation at index %d. Got %v", i, *elevations[i])
+			}
+			continue
+		}
+		if elevations[i] == nil || *elevations[i] != expected[i] {
+			t.Errorf("Expected elevation %v at index %d. Got %v", expected[i], i, elevations[i])
+		}
+	}
+
+	chunked.Provider = latitudeElevation{failAt: 1}
+	chunked.ChunkSize = 10
+	if _, err := chunked.Lookup(context.Background(), locations[:1]); err == nil || errors.As(err, &partialErr) {
+		t.Errorf("Expected a complete failure. Got %v", err)
+	}
+}
+
+func TestDecodeElevation(t *testing.T) {
+	elevations, err := gmap.DecodeElevation("0a-2.4anulla4.5a", 5)
+	if err != nil {
+		t.Fatalf("failed to decode elevations: %v", err)
+	}
+	expected := []*float64{float64Ptr(0), float64Ptr(-2.4), nil, float64Ptr(4.5), nil}
+	for i := range expected {
+		if (elevations[i] == nil) != (expected[i] == nil) || elevations[i] != nil && *elevations[i] != *expected[i] {
+			t.Errorf("Expected elevation %v at index %d. Got %v", expected[i], i, elevations[i])
+		}
+	}
+
+	// Payloads in another layout are rejected rather than misread.
+	for _, elev := range []string{"0a1", "0,1,2", "[0,1,2]"} {
+		if _, err := gmap.DecodeElevation(elev, 3); err == nil {
+			t.Errorf("Expected an error decoding %q", elev)
+		}
+	}
+}
+
+func TestNewElevationProviderFallback(t *testing.T) {
+	if _, err := data.NewElevationProvider(data.ElevationConfig{Provider: data.ElevationFake, Fallback: data.ElevationGoogle}); err == nil {
+		t.Errorf("Expected a fallback for a provider without one to be rejected")
+	}
+
+	provider, err := data.NewElevationProvider(data.ElevationConfig{Provider: data.ElevationSRTM, SRTMDir: t.TempDir(), Fallback: data.ElevationFake})
+	if err != nil {
+		t.Fatalf("Expected srtm to accept a fallback. Got %v", err)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		closer.Close()
+	}
+}
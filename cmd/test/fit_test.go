@@ -0,0 +1,73 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"testing"
+)
+
+// fitMessageCounts walks the records of a FIT file and counts the data messages per global message number.
+func fitMessageCounts(t *testing.T, records []byte) map[uint16]int {
+	globals := map[byte]uint16{}
+	sizes := map[byte]int{}
+	counts := map[uint16]int{}
+	for i := 0; i < len(records); {
+		header := records[i]
+		local := header & 0x0F
+		i++
+		if header&0x40 != 0 {
+			globals[local] = binary.LittleEndian.Uint16(records[i+2:])
+			fields := int(records[i+4])
+			size := 0
+			for f := 0; f < fields; f++ {
+				size += int(records[i+5+3*f+1])
+			}
+			sizes[local] = size
+			i += 5 + 3*fields
+			continue
+		}
+		size, ok := sizes[local]
+		if !ok {
+			t.Fatalf("data message for undefined local message %d", local)
+		}
+		counts[globals[local]]++
+		i += size
+	}
+	return counts
+}
+
+func TestEncodeFIT(t *testing.T) {
+	// The FIT CRC is CRC-16/ARC, whose check value is 0xbb3d.
+	if crc := export.FITCRC(0, []byte("123456789")); crc != 0xbb3d {
+		t.Fatalf("Expected check value bb3d. Got %x", crc)
+	}
+
+	var buf bytes.Buffer
+	if err := export.EncodeFIT(&buf, testTrack()); err != nil {
+		t.Fatalf("failed to encode fit: %v", err)
+	}
+	file := buf.Bytes()
+
+	if len(file) < 16 || file[0] != 14 || string(file[8:12]) != ".FIT" {
+		t.Fatalf("invalid fit header % x", file[:14])
+	}
+	if crc := binary.LittleEndian.Uint16(file[12:]); crc != export.FITCRC(0, file[:12]) {
+		t.Errorf("Expected header crc %x. Got %x", export.FITCRC(0, file[:12]), crc)
+	}
+	dataSize := int(binary.LittleEndian.Uint32(file[4:]))
+	if dataSize != len(file)-16 {
+		t.Fatalf("Expected data size %d. Got %d", len(file)-16, dataSize)
+	}
+	if crc := export.FITCRC(0, file); crc != 0 {
+		t.Errorf("Expected the file crc to check out. Got remainder %x", crc)
+	}
+
+	counts := fitMessageCounts(t, file[14:14+dataSize])
+	expected := map[uint16]int{0: 1, 31: 1, 19: 1, 21: 2, 20: 3, 32: 1}
+	for global, count := range expected {
+		if counts[global] != count {
+			t.Errorf("Expected %d messages of type %d. Got %d", count, global, counts[global])
+		}
+	}
+}
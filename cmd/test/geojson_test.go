@@ -0,0 +1,44 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"testing"
+)
+
+func TestEncodeGeoJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.EncodeGeoJSON(&buf, testTrack()); err != nil {
+		t.Fatalf("failed to encode geojson: %v", err)
+	}
+
+	var doc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse geojson: %v", err)
+	}
+	if doc.Type != "FeatureCollection" || len(doc.Features) != 2 {
+		t.Fatalf("Expected a collection with a route and a waypoint. Got %s with %d features", doc.Type, len(doc.Features))
+	}
+
+	route := doc.Features[0]
+	expected := `[[-52.71244,47.56183,0],[-52.70882,47.56401,-2.5],[0.00001,47.56712]]`
+	if route.Geometry.Type != "LineString" || string(route.Geometry.Coordinates) != expected {
+		t.Errorf("Expected LineString %s. Got %s %s", expected, route.Geometry.Type, route.Geometry.Coordinates)
+	}
+	if route.Properties["routeID"] != float64(7696696) || route.Properties["elevationLoss"] != 2.5 {
+		t.Errorf("Unexpected route properties %v", route.Properties)
+	}
+	if distance, _ := route.Properties["distance"].(float64); distance < 3870000 || distance > 3880000 {
+		t.Errorf("Expected a distance of about 3877 km. Got %v", route.Properties["distance"])
+	}
+}
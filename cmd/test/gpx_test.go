@@ -0,0 +1,94 @@
+package test
+
+import (
+	"bytes"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func testTrack() *export.Track {
+	return &export.Track{
+		Name:        "Signal Hill Loop",
+		Description: "Up & over <Signal Hill>",
+		Link:        "https://www.gmap-pedometer.com/?r=7696696",
+		RouteID:     7696696,
+		Time:        time.Date(2023, 2, 1, 12, 0, 0, 0, time.UTC),
+		Points: []geo.Point{
+			{LatLng: geo.LatLng{Lat: 47.56183, Lng: -52.71244}, Elevation: float64Ptr(0)},
+			{LatLng: geo.LatLng{Lat: 47.56401, Lng: -52.70882}, Elevation: float64Ptr(-2.5)},
+			{LatLng: geo.LatLng{Lat: 47.56712, Lng: 0.00001}},
+		},
+		Waypoints: []export.Waypoint{
+			{LatLng: geo.LatLng{Lat: 47.56712, Lng: -52.70405}, Name: "Aid station 1", Description: "Water"},
+		},
+	}
+}
+
+// TestGPXSchema validates the generated GPX against the vendored GPX 1.1 schema with xmllint.
+func TestGPXSchema(t *testing.T) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not installed")
+	}
+
+	var buf bytes.Buffer
+	if err := export.EncodeGPX(&buf, testTrack(), export.Options{GPXType: export.GPXTypeBoth, MaxRoutePoints: 2}); err != nil {
+		t.Fatalf("failed to encode gpx: %v", err)
+	}
+	for _, want := range []string{"<ele>0</ele>", "<ele>-2.5</ele>", `lon="0.00001"`, "<rtept", "<trkpt"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("Expected gpx to contain %s", want)
+		}
+	}
+
+	gpxPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := os.WriteFile(gpxPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write gpx: %v", err)
+	}
+	out, err := exec.Command(xmllint, "--noout", "--schema", "testdata/gpx/gpx.xsd", gpxPath).CombinedOutput()
+	if err != nil {
+		t.Errorf("gpx failed schema validation: %v\n%s\n%s", err, out, buf.String())
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	points := []geo.LatLng{
+		{Lat: 0, Lng: 0},
+		{Lat: 0.0001, Lng: 0.001},
+		{Lat: 0.01, Lng: 0.002},
+		{Lat: -0.0002, Lng: 0.003},
+		{Lat: 0, Lng: 0.004},
+	}
+
+	kept := geo.Simplify(points, 3)
+	if len(kept) != 3 || kept[0] != 0 || kept[1] != 2 || kept[2] != 4 {
+		t.Errorf("Expected the ends and the outlier to be kept. Got %v", kept)
+	}
+	if kept := geo.Simplify(points, 250); len(kept) != len(points) {
+		t.Errorf("Expected every point to be kept. Got %v", kept)
+	}
+
+	long := make([]geo.LatLng, 10000)
+	for i := range long {
+		long[i] = geo.LatLng{Lat: math.Sin(float64(i) / 50), Lng: float64(i) / 1000}
+	}
+	kept = geo.Simplify(long, export.MaxRoutePointsLimit)
+	if len(kept) != export.MaxRoutePointsLimit || kept[0] != 0 || kept[len(kept)-1] != len(long)-1 {
+		t.Fatalf("Expected %d points including both ends. Got %d", export.MaxRoutePointsLimit, len(kept))
+	}
+	for i := 1; i < len(kept); i++ {
+		if kept[i] <= kept[i-1] {
+			t.Fatalf("Expected increasing indexes. Got %d after %d", kept[i], kept[i-1])
+		}
+	}
+}
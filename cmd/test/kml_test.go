@@ -0,0 +1,35 @@
+package test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"testing"
+)
+
+func TestEncodeKML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.EncodeKML(&buf, testTrack()); err != nil {
+		t.Fatalf("failed to encode kml: %v", err)
+	}
+
+	var doc export.KML
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse kml: %v", err)
+	}
+	placemarks := doc.Document.Placemarks
+	if len(placemarks) != 2 {
+		t.Fatalf("Expected a route and a waypoint placemark. Got %d placemarks", len(placemarks))
+	}
+	line := placemarks[0].LineString
+	if line == nil || line.AltitudeMode != "clampToGround" {
+		t.Fatalf("Expected a ground clamped line string. Got %+v", line)
+	}
+	expected := "-52.71244,47.56183,0 -52.70882,47.56401,-2.5 0.00001,47.56712"
+	if line.Coordinates != expected {
+		t.Errorf("Expected coordinates %q. Got %q", expected, line.Coordinates)
+	}
+	if placemarks[1].Point == nil || placemarks[1].Name != "Aid station 1" {
+		t.Errorf("Unexpected waypoint placemark %+v", placemarks[1])
+	}
+}
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	start := time.Date(2023, 6, 4, 8, 0, 0, 0, time.UTC)
+	points := []geo.Point{
+		{LatLng: geo.LatLng{Lat: 0, Lng: 0}, Elevation: float64Ptr(0)},
+		{LatLng: geo.LatLng{Lat: 0.01, Lng: 0}, Elevation: float64Ptr(50)},
+	}
+	segment := geo.Distance(points[0].LatLng, points[1].LatLng)
+
+	// A 5 min/km pace.
+	geo.Timestamp(points, start, 1000.0/300, false)
+	if !points[0].Time.Equal(start) {
+		t.Errorf("Expected the first point at %v. Got %v", start, points[0].Time)
+	}
+	flat := points[1].Time.Sub(start).Seconds()
+	if expected := segment * 0.3; flat < expected-0.01 || flat > expected+0.01 {
+		t.Errorf("Expected %.2fs to the second point. Got %.2fs", expected, flat)
+	}
+
+	geo.Timestamp(points, start, 1000.0/300, true)
+	if climb := points[1].Time.Sub(start).Seconds(); climb <= flat {
+		t.Errorf("Expected a grade adjusted climb to take longer than %.2fs. Got %.2fs", flat, climb)
+	}
+}
+
+func TestTimestampDrift(t *testing.T) {
+	start := time.Date(2023, 6, 4, 8, 0, 0, 0, time.UTC)
+	points := make([]geo.Point, 5000)
+	total := 0.0
+	for i := range points {
+		points[i].LatLng = geo.LatLng{Lat: float64(i) / 100000}
+		if i > 0 {
+			total += geo.Distance(points[i-1].LatLng, points[i].LatLng)
+		}
+	}
+
+	geo.Timestamp(points, start, 1, false)
+	expected := start.Add(time.Duration(total * float64(time.Second)))
+	if drift := expected.Sub(*points[len(points)-1].Time); drift < 0 || drift > time.Millisecond {
+		t.Errorf("Expected the last point within a millisecond of %v. Got %v", expected, points[len(points)-1].Time)
+	}
+}
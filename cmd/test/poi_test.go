@@ -0,0 +1,35 @@
+package test
+
+import (
+	"errors"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"testing"
+)
+
+func TestDecodePointsOfInterest(t *testing.T) {
+	pois, err := gmap.DecodePointsOfInterest("47.56712,-52.70405,Aid+station+1,Water%2C+gels;;47.56947,-52.68203,Cabot+Tower")
+	if err != nil {
+		t.Fatalf("failed to decode points of interest: %v", err)
+	}
+	if len(pois) != 2 {
+		t.Fatalf("Expected 2 points of interest. Got %d", len(pois))
+	}
+	if pois[0].Name != "Aid station 1" || pois[0].Description != "Water, gels" || pois[0].Lat != 47.56712 {
+		t.Errorf("Unexpected first point of interest %+v", pois[0])
+	}
+	if pois[1].Name != "Cabot Tower" || pois[1].Description != "" {
+		t.Errorf("Unexpected second point of interest %+v", pois[1])
+	}
+
+	pois, err = gmap.DecodePointsOfInterest("47.56712,west,Aid;47.56947,-52.68203,Cabot+Tower;91,0,North;1,2,%zz")
+	var skippedErr *gmap.SkippedPointsOfInterestError
+	if !errors.As(err, &skippedErr) {
+		t.Fatalf("Expected a SkippedPointsOfInterestError. Got %v", err)
+	}
+	if len(skippedErr.Skipped) != 3 || skippedErr.Skipped[0].Index != 0 || skippedErr.Skipped[2].Index != 3 {
+		t.Errorf("Expected markers 0, 2 and 3 to be skipped. Got %+v", skippedErr.Skipped)
+	}
+	if len(pois) != 1 || pois[0].Name != "Cabot Tower" {
+		t.Errorf("Expected the valid marker to be kept. Got %+v", pois)
+	}
+}
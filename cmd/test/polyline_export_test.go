@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"testing"
+)
+
+func TestEncodePolyline(t *testing.T) {
+	// The example from Google's encoded polyline algorithm documentation.
+	track := &export.Track{Points: []geo.Point{
+		{LatLng: geo.LatLng{Lat: 38.5, Lng: -120.2}},
+		{LatLng: geo.LatLng{Lat: 40.7, Lng: -120.95}},
+		{LatLng: geo.LatLng{Lat: 43.252, Lng: -126.453}},
+	}}
+
+	var buf bytes.Buffer
+	if err := export.EncodePolyline(&buf, track, export.Options{}); err != nil {
+		t.Fatalf("failed to encode polyline: %v", err)
+	}
+	if expected := "_p~iF~ps|U_ulLnnqC_mqNvxq`@"; buf.String() != expected {
+		t.Errorf("Expected polyline %q. Got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := export.EncodePolyline(&buf, track, export.Options{Precision: 6}); err != nil {
+		t.Fatalf("failed to encode polyline: %v", err)
+	}
+	if expected := "_izlhA~rlgdF_{geC~ywl@_kwzCn`{nI"; buf.String() != expected {
+		t.Errorf("Expected polyline6 %q. Got %q", expected, buf.String())
+	}
+}
+
+func TestEncodeEWKT(t *testing.T) {
+	var buf bytes.Buffer
+	track := testTrack()
+	if err := export.EncodeEWKT(&buf, track, export.Options{}); !errors.Is(err, export.ErrMissingElevation) {
+		t.Errorf("Expected ErrMissingElevation without all elevations. Got %v", err)
+	}
+	buf.Reset()
+	if err := export.EncodeEWKT(&buf, track, export.Options{Force2D: true}); err != nil {
+		t.Fatalf("failed to encode ewkt: %v", err)
+	}
+	if expected := "SRID=4326;LINESTRING (-52.71244 47.56183, -52.70882 47.56401, 0.00001 47.56712)"; buf.String() != expected {
+		t.Errorf("Expected %q. Got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	track.Points[2].Elevation = float64Ptr(12)
+	if err := export.EncodeWKT(&buf, track, export.Options{}); err != nil {
+		t.Fatalf("failed to encode wkt: %v", err)
+	}
+	if expected := "LINESTRING Z (-52.71244 47.56183 0, -52.70882 47.56401 -2.5, 0.00001 47.56712 12)"; buf.String() != expected {
+		t.Errorf("Expected %q. Got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"errors"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"math"
+	"testing"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	type test struct {
+		desc     string
+		polyline string
+		points   int
+		errIndex int
+	}
+
+	tt := []test{
+		{desc: "Two points", polyline: "47.56183a-52.71244a47.56401a-52.70882", points: 2, errIndex: -1},
+		{desc: "Odd token count", polyline: "47.56183a-52.71244a47.56401", errIndex: 2},
+		{desc: "Not a number", polyline: "47.56183a-52.71244a47.5x401a-52.70882", errIndex: 2},
+		{desc: "Empty token", polyline: "47.56183aa47.56401a-52.70882", errIndex: 1},
+		{desc: "Latitude out of range", polyline: "91a-52.71244", errIndex: 0},
+		{desc: "Longitude out of range", polyline: "47.56183a-180.5", errIndex: 1},
+		{desc: "Infinity", polyline: "Infa0", errIndex: 0},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			points, err := gmap.DecodePolyline(tc.polyline)
+			if tc.errIndex < 0 {
+				if err != nil {
+					t.Fatalf("failed to decode polyline: %v", err)
+				}
+				if len(points) != tc.points {
+					t.Errorf("Expected %d points. Got %d", tc.points, len(points))
+				}
+				return
+			}
+
+			var polyErr *gmap.PolylineError
+			if !errors.As(err, &polyErr) {
+				t.Fatalf("Expected a polyline error. Got %v", err)
+			}
+			if polyErr.Index != tc.errIndex {
+				t.Errorf("Expected error at index %d. Got %d", tc.errIndex, polyErr.Index)
+			}
+		})
+	}
+
+	if _, err := gmap.DecodePolyline(""); !errors.Is(err, gmap.ErrEmptyPolyline) {
+		t.Errorf("Expected ErrEmptyPolyline. Got %v", err)
+	}
+}
+
+func FuzzDecodePolyline(f *testing.F) {
+	f.Add("47.56183a-52.71244a47.56401a-52.70882")
+	f.Add("47.56183a-52.71244a47.56401")
+	f.Add("0a0")
+	f.Add("1e3a-Inf")
+	f.Fuzz(func(t *testing.T, polyline string) {
+		points, err := gmap.DecodePolyline(polyline)
+		if err != nil {
+			var polyErr *gmap.PolylineError
+			if !errors.Is(err, gmap.ErrEmptyPolyline) && !errors.As(err, &polyErr) {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			return
+		}
+		for _, p := range points {
+			if math.IsNaN(p.Lat) || math.IsNaN(p.Lng) || math.Abs(p.Lat) > 90 || math.Abs(p.Lng) > 180 {
+				t.Fatalf("decoded invalid point %+v from %q", p, polyline)
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"context"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap/gmaptest"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// recordedDir holds real ajaxRoute responses of recordedRoutes. Run the suite with GMAP_RECORD=1 and network access
+// to gmap-pedometer to record them.
+const recordedDir = "testdata/gmap/recorded"
+
+var recordedRoutes = []int{5000001, 7696696}
+
+// TestRecordedRoutes checks the decoders against real ajaxRoute responses, unlike the synthetic fixtures which only
+// follow the layout the decoders expect.
+func TestRecordedRoutes(t *testing.T) {
+	if os.Getenv("GMAP_RECORD") != "" {
+		if err := gmaptest.Record(context.Background(), gmap.DefaultBaseURL, recordedDir, recordedRoutes...); err != nil {
+			t.Fatalf("failed to record routes: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(recordedDir, strconv.Itoa(recordedRoutes[0])+".txt")); os.IsNotExist(err) {
+		t.Skipf("no recorded responses in %s, run with GMAP_RECORD=1 to record them", recordedDir)
+	}
+
+	for _, routeID := range recordedRoutes {
+		t.Run(strconv.Itoa(routeID), func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join(recordedDir, strconv.Itoa(routeID)+".txt"))
+			if err != nil {
+				t.Fatalf("failed to read the recorded response: %v", err)
+			}
+			route, err := gmap.ParseRoute(body)
+			if err != nil {
+				t.Fatalf("failed to parse the recorded response: %v", err)
+			}
+			points, err := gmap.DecodePolyline(route.Polyline)
+			if err != nil {
+				t.Fatalf("failed to decode the polyline: %v", err)
+			}
+			if len(points) == 0 {
+				t.Errorf("Expected the route to have points")
+			}
+
+			// elev must hold one value per polyline point, in meters: within the elevations found on land and
+			// without grades between points that no route climbs, as feet would give.
+			elevations, err := gmap.DecodeElevation(route.Elevation, len(points))
+			if err != nil {
+				t.Fatalf("failed to decode the elevations: %v", err)
+			}
+			for i, elevation := range elevations {
+				if elevation == nil {
+					continue
+				}
+				if *elevation < -430 || *elevation > 8849 {
+					t.Errorf("Expected elevation %d in meters. Got %v", i, *elevation)
+				}
+				if i == 0 || elevations[i-1] == nil {
+					continue
+				}
+				if d := geo.Distance(points[i-1], points[i]); d > 10 && math.Abs(*elevation-*elevations[i-1]) > d {
+					t.Errorf("Expected at most a 100%% grade between points %d and %d. Got %v over %.0f m", i-1, i, *elevation-*elevations[i-1], d)
+				}
+			}
+
+			// Every pta marker must decode, and lie near the route it was placed on.
+			pois, err := gmap.DecodePointsOfInterest(route.PointOfInterest)
+			if err != nil {
+				t.Fatalf("failed to decode the points of interest: %v", err)
+			}
+			for _, poi := range pois {
+				nearest := math.Inf(1)
+				for _, p := range points {
+					nearest = math.Min(nearest, geo.Distance(p, poi.LatLng))
+				}
+				if nearest > 1000 {
+					t.Errorf("Expected point of interest %q near the route. Got %.0f m away", poi.Name, nearest)
+				}
+			}
+		})
+	}
+}
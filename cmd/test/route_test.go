@@ -0,0 +1,29 @@
+package test
+
+import (
+	"github.com/zcvaters/gmap-to-gpx/cmd/gmap"
+	"testing"
+)
+
+func TestParseRoutePayloadHash(t *testing.T) {
+	const body = "rId=7696696&polyline=47.56183a-52.71244a47.56401a-52.70882&elev=12.5a30&name=Loop&rdm="
+
+	parse := func(body string) string {
+		route, err := gmap.ParseRoute([]byte(body))
+		if err != nil {
+			t.Fatalf("Expected the route to parse. Got %v", err)
+		}
+		return route.PayloadHash
+	}
+
+	hash := parse(body + "1234")
+	if other := parse(body + "5678"); other != hash {
+		t.Errorf("Expected responses differing only in rdm to hash the same. Got %q and %q", hash, other)
+	}
+	if other := parse("rId=7696696&polyline=47.56183a-52.71244&elev=12.5a30&name=Loop&rdm=1234"); other == hash {
+		t.Errorf("Expected another polyline to hash differently. Got %q for both", hash)
+	}
+	if other := parse(body + "1234&description=Around+the+pond"); other == hash {
+		t.Errorf("Expected another description to hash differently. Got %q for both", hash)
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSRTMTile writes a 3 arc-second tile where every sample's elevation is its column index.
+func writeSRTMTile(t *testing.T, dir, name string) {
+	const samples = 1201
+	buf := make([]byte, 2*samples*samples)
+	for row := 0; row < samples; row++ {
+		for col := 0; col < samples; col++ {
+			binary.BigEndian.PutUint16(buf[2*(row*samples+col):], uint16(col))
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".hgt"), buf, 0o644); err != nil {
+		t.Fatalf("failed to write tile: %v", err)
+	}
+}
+
+func TestSRTMElevation(t *testing.T) {
+	dir := t.TempDir()
+	writeSRTMTile(t, dir, "N47W053")
+	srtm := data.NewSRTMElevation(dir, 1, &data.FakeElevation{Elevation: -1})
+	defer srtm.Close()
+
+	locations := []geo.LatLng{
+		{Lat: 47.5, Lng: -53},
+		{Lat: 47.5, Lng: -52.5},
+		{Lat: 47.25, Lng: -53 + 600.5/1200},
+		{Lat: 10.5, Lng: 20.5},
+	}
+	expected := []float64{0, 600, 600.5, -1}
+
+	elevations, err := srtm.Lookup(context.Background(), locations)
+	if err != nil {
+		t.Fatalf("failed to look up elevations: %v", err)
+	}
+	if len(elevations) != len(expected) {
+		t.Fatalf("Expected %d elevations. Got %d", len(expected), len(elevations))
+	}
+	for i := range expected {
+		if elevations[i] == nil || math.Abs(*elevations[i]-expected[i]) > 1e-6 {
+			t.Errorf("Expected elevation %v at %v. Got %v", expected[i], locations[i], elevations[i])
+		}
+	}
+
+	noFallback := data.NewSRTMElevation(dir, 1, nil)
+	defer noFallback.Close()
+	elevations, err = noFallback.Lookup(context.Background(), locations[2:])
+	if err != nil {
+		t.Fatalf("failed to look up elevations: %v", err)
+	}
+	if elevations[0] == nil || elevations[1] != nil {
+		t.Errorf("Expected an elevation only for the location with a tile. Got %v", elevations)
+	}
+}
+
+func TestSRTMElevationPartialFallback(t *testing.T) {
+	dir := t.TempDir()
+	writeSRTMTile(t, dir, "N47W053")
+	// The fallback looks up one location per chunk and fails the one at latitude 11.5.
+	fallback := &data.ChunkedElevation{Provider: latitudeElevation{failAt: 11.5}, ChunkSize: 1, Concurrency: 1}
+	srtm := data.NewSRTMElevation(dir, 1, fallback)
+	defer srtm.Close()
+
+	locations := []geo.LatLng{{Lat: 47.5, Lng: -53}, {Lat: 10.5, Lng: 20.5}, {Lat: 11.5, Lng: 20.5}}
+	elevations, err := srtm.Lookup(context.Background(), locations)
+
+	var partialErr *data.PartialElevationError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("Expected a partial elevation error. Got %v", err)
+	}
+	if len(elevations) != len(locations) {
+		t.Fatalf("Expected %d elevations. Got %d", len(locations), len(elevations))
+	}
+	if elevations[0] == nil || *elevations[0] != 0 {
+		t.Errorf("Expected the tile elevation to be kept. Got %v", elevations[0])
+	}
+	if elevations[1] == nil || *elevations[1] != 10.5 {
+		t.Errorf("Expected the fallback elevation to be kept. Got %v", elevations[1])
+	}
+	if elevations[2] != nil {
+		t.Errorf("Expected no elevation for the failed chunk. Got %v", *elevations[2])
+	}
+}
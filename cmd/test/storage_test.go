@@ -0,0 +1,181 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/zcvaters/gmap-to-gpx/cmd/data"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	storage, err := data.NewLocalStorage(t.TempDir(), "http://localhost:8080/api/v1/files/", []byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	obj := data.Object{
+		Key:                "abc/Signal Hill Loop.gpx",
+		ContentType:        "application/gpx+xml",
+		ContentDisposition: "attachment",
+		CacheControl:       data.DefaultCacheControl,
+		Metadata:           map[string]string{"route-id": "7696696"},
+	}
+	if _, err := storage.Stat(ctx, obj.Key); !errors.Is(err, data.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound before put. Got %v", err)
+	}
+	if err := storage.Put(ctx, obj, []byte("<gpx/>")); err != nil {
+		t.Fatalf("failed to put object: %v", err)
+	}
+
+	stat, err := storage.Stat(ctx, obj.Key)
+	if err != nil {
+		t.Fatalf("failed to stat object: %v", err)
+	}
+	if stat.Size != 6 || stat.ContentType != obj.ContentType || stat.Created.IsZero() {
+		t.Errorf("Expected size 6 and content type %q. Got %+v", obj.ContentType, stat)
+	}
+	if stat.CacheControl != obj.CacheControl || stat.Metadata["route-id"] != "7696696" {
+		t.Errorf("Expected the cache control and metadata of %+v. Got %+v", obj, stat)
+	}
+	body, _, err := storage.Get(ctx, obj.Key)
+	if err != nil || string(body) != "<gpx/>" {
+		t.Errorf("Expected body <gpx/>. Got %q, %v", body, err)
+	}
+
+	for _, key := range []string{"../escape.gpx", "/abs.gpx", ""} {
+		if err := storage.Put(ctx, data.Object{Key: key}, nil); err == nil {
+			t.Errorf("Expected invalid key %q to be rejected", key)
+		}
+	}
+
+	if err := storage.Delete(ctx, obj.Key); err != nil {
+		t.Fatalf("failed to delete object: %v", err)
+	}
+	if _, _, err := storage.Get(ctx, obj.Key); !errors.Is(err, data.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound after delete. Got %v", err)
+	}
+	if err := storage.Delete(ctx, obj.Key); !errors.Is(err, data.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound deleting twice. Got %v", err)
+	}
+}
+
+func TestLocalStorageSignedURL(t *testing.T) {
+	storage, err := data.NewLocalStorage(t.TempDir(), "http://localhost:8080/api/v1/files", []byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	obj := data.Object{Key: "abc/Signal Hill Loop.gpx", ContentType: "application/gpx+xml", ContentDisposition: "attachment"}
+	signed, err := storage.SignedURL(context.Background(), obj, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to sign url: %v", err)
+	}
+	if !strings.HasPrefix(signed, "http://localhost:8080/api/v1/files/abc/Signal%20Hill%20Loop.gpx?") {
+		t.Errorf("Expected the escaped key below the base url. Got %q", signed)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("failed to parse signed url: %v", err)
+	}
+
+	verified, err := storage.Verify(obj.Key, u.Query(), time.Now())
+	if err != nil {
+		t.Fatalf("failed to verify signed url: %v", err)
+	}
+	if verified.ContentType != obj.ContentType || verified.ContentDisposition != obj.ContentDisposition {
+		t.Errorf("Expected the signed headers of %+v. Got %+v", obj, verified)
+	}
+
+	if _, err := storage.Verify("abc/other.gpx", u.Query(), time.Now()); !errors.Is(err, data.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another key. Got %v", err)
+	}
+	tampered := u.Query()
+	tampered.Set("type", "text/html")
+	if _, err := storage.Verify(obj.Key, tampered, time.Now()); !errors.Is(err, data.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a changed content type. Got %v", err)
+	}
+	if _, err := storage.Verify(obj.Key, u.Query(), time.Now().Add(2*time.Minute)); !errors.Is(err, data.ErrURLExpired) {
+		t.Errorf("Expected ErrURLExpired. Got %v", err)
+	}
+}
+
+func TestS3SignedURL(t *testing.T) {
+	client, err := data.NewS3Client(data.S3Config{
+		Endpoint:        "localhost:9000",
+		Region:          "us-east-1",
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minioadmin",
+		Insecure:        true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create s3 client: %v", err)
+	}
+	storage := &data.S3{Client: client, BucketID: "gpx"}
+	obj := data.Object{Key: "abc/loop.gpx", ContentType: "application/gpx+xml", ContentDisposition: "attachment; filename=loop.gpx"}
+
+	signed, err := storage.SignedURL(context.Background(), obj, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to presign url: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("failed to parse presigned url: %v", err)
+	}
+	if u.Host != "localhost:9000" || u.Path != "/gpx/abc/loop.gpx" {
+		t.Errorf("Expected a path style url of the object. Got %q", signed)
+	}
+	query := u.Query()
+	if query.Get("response-content-type") != obj.ContentType || query.Get("response-content-disposition") != obj.ContentDisposition {
+		t.Errorf("Expected the response headers in the query. Got %q", signed)
+	}
+	if query.Get("X-Amz-Expires") != "60" || query.Get("X-Amz-Signature") == "" {
+		t.Errorf("Expected a signature valid for 60 seconds. Got %q", signed)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	storage, err := data.NewLocalStorage(t.TempDir(), "http://localhost:8080/api/v1/files", []byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	for _, key := range []string{"conversions/a.gpx", "conversions/nested/b.kml", "conversionsc.tcx", "other/d.gpx"} {
+		if err := storage.Put(ctx, data.Object{Key: key}, []byte(key)); err != nil {
+			t.Fatalf("failed to put object: %v", err)
+		}
+	}
+
+	var listed []string
+	if err := storage.List(ctx, data.ConversionPrefix, func(obj data.Object) error {
+		listed = append(listed, obj.Key)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to list objects: %v", err)
+	}
+	if len(listed) != 2 || listed[0] != "conversions/a.gpx" || listed[1] != "conversions/nested/b.kml" {
+		t.Errorf("Expected [conversions/a.gpx conversions/nested/b.kml]. Got %v", listed)
+	}
+
+	deleted, err := data.PurgeExpired(ctx, storage, data.ConversionPrefix, time.Now().Add(-time.Hour))
+	if err != nil || deleted != 0 {
+		t.Errorf("Expected no objects older than an hour. Got %d, %v", deleted, err)
+	}
+	deleted, err = data.PurgeExpired(ctx, storage, data.ConversionPrefix, time.Now().Add(time.Second))
+	if err != nil || deleted != 2 {
+		t.Errorf("Expected both conversions to be purged. Got %d, %v", deleted, err)
+	}
+	if _, err := storage.Stat(ctx, "conversions/nested/b.kml"); !errors.Is(err, data.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound after purging. Got %v", err)
+	}
+	for _, key := range []string{"conversionsc.tcx", "other/d.gpx"} {
+		if _, err := storage.Stat(ctx, key); err != nil {
+			t.Errorf("Expected %s outside the prefix to be kept. Got %v", key, err)
+		}
+	}
+	if _, err := data.PurgeExpired(ctx, storage, "missing/", time.Now()); err != nil {
+		t.Errorf("Expected purging a missing prefix to succeed. Got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/zcvaters/gmap-to-gpx/cmd/export"
+	"github.com/zcvaters/gmap-to-gpx/cmd/geo"
+	"testing"
+	"time"
+)
+
+func TestEncodeTCX(t *testing.T) {
+	track := testTrack()
+	// Head north east, then turn south east.
+	track.Points[2].LatLng = geo.LatLng{Lat: 47.56183, Lng: -52.70405}
+
+	var buf bytes.Buffer
+	if err := export.EncodeTCX(&buf, track); err != nil {
+		t.Fatalf("failed to encode tcx: %v", err)
+	}
+	var doc export.TCX
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse tcx: %v", err)
+	}
+	if len(doc.Courses) != 1 {
+		t.Fatalf("Expected one course. Got %d", len(doc.Courses))
+	}
+
+	course := doc.Courses[0]
+	if course.Name != "Signal Hill Loo" {
+		t.Errorf("Expected the course name to be cut to 15 characters. Got %q", course.Name)
+	}
+	if len(course.Track) != 3 {
+		t.Fatalf("Expected 3 trackpoints. Got %d", len(course.Track))
+	}
+	for i := 1; i < len(course.Track); i++ {
+		if course.Track[i].DistanceMeters <= course.Track[i-1].DistanceMeters || !course.Track[i].Time.After(course.Track[i-1].Time) {
+			t.Errorf("Expected distance and time to increase at trackpoint %d", i)
+		}
+	}
+	if course.Lap.DistanceMeters != course.Track[2].DistanceMeters {
+		t.Errorf("Expected lap distance %v. Got %v", course.Track[2].DistanceMeters, course.Lap.DistanceMeters)
+	}
+
+	var types []string
+	for _, p := range course.CoursePoint {
+		types = append(types, p.PointType)
+	}
+	if len(types) != 2 || types[0] != "Right" || types[1] != "Generic" {
+		t.Errorf("Expected a right turn then the aid station. Got %v", types)
+	}
+}
+
+func TestEncodeTCXTimeDrift(t *testing.T) {
+	track := &export.Track{Name: "Ultra", Time: time.Date(2023, 2, 1, 12, 0, 0, 0, time.UTC), Points: make([]geo.Point, 5000)}
+	total := 0.0
+	for i := range track.Points {
+		track.Points[i].LatLng = geo.LatLng{Lat: float64(i) / 100000}
+		if i > 0 {
+			total += geo.Distance(track.Points[i-1].LatLng, track.Points[i].LatLng)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := export.EncodeTCX(&buf, track); err != nil {
+		t.Fatalf("failed to encode tcx: %v", err)
+	}
+	var doc export.TCX
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse tcx: %v", err)
+	}
+
+	last := doc.Courses[0].Track[len(track.Points)-1]
+	expected := track.Time.Add(time.Duration(total / export.CourseSpeed * float64(time.Second)))
+	if drift := expected.Sub(last.Time); drift < -time.Millisecond || drift > time.Millisecond {
+		t.Errorf("Expected the last trackpoint within a millisecond of %v. Got %v", expected, last.Time)
+	}
+}